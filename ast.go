@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+)
+
+// usage: zlang ast [--format=json|sexpr] [file | -]
+//
+// ast prints the syntax tree of file, or of standard input, as indented JSON
+// or as an S-expression.
+func astCmd(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	format := flags.String("format", "sexpr", "output format, json or sexpr")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: zlang ast [--format=json|sexpr] [file | -]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if (*format != "json" && *format != "sexpr") || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	filename, in := "<stdin>", io.Reader(os.Stdin)
+	if flags.NArg() == 1 && flags.Arg(0) != "-" {
+		filename = flags.Arg(0)
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		defer f.Close()
+		in = f
+	}
+
+	src, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	l := lexer.NewFile(filename, string(src))
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		p.Errors().WriteText(os.Stderr, string(src))
+		return 1
+	}
+
+	if *format == "sexpr" {
+		ast.Fprint(os.Stdout, program)
+		return 0
+	}
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	out.WriteByte('\n')
+	os.Stdout.Write(out.Bytes())
+	return 0
+}
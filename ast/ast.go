@@ -3,11 +3,14 @@ package ast
 import (
 	"bytes"
 	"github.com/abusizhishen/zlang/token"
+	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 }
 
 type Statement interface {
@@ -30,6 +33,17 @@ type IntegerLiteral struct {
 	Value int64
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FloatLiteral) End() token.Position  { return f.Token.End }
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -38,6 +52,8 @@ type PrefixExpression struct {
 
 func (p *PrefixExpression) expressionNode()      {}
 func (p *PrefixExpression) TokenLiteral() string { return p.Token.Literal }
+func (p *PrefixExpression) Pos() token.Position  { return p.Token.Pos }
+func (p *PrefixExpression) End() token.Position  { return endOf(p.Right, p.Token.End) }
 func (p *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -49,6 +65,8 @@ func (p *PrefixExpression) String() string {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return posOf(es.Expression, es.Token.Pos) }
+func (es *ExpressionStatement) End() token.Position  { return endOf(es.Expression, es.Token.End) }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -57,10 +75,48 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+// BadStatement is a placeholder for a statement that could not be parsed,
+// covering the source the parser skipped.
+type BadStatement struct {
+	From, To token.Position
+}
+
+func (b *BadStatement) statementNode()       {}
+func (b *BadStatement) TokenLiteral() string { return "" }
+func (b *BadStatement) String() string       { return "<bad statement>" }
+func (b *BadStatement) Pos() token.Position  { return b.From }
+func (b *BadStatement) End() token.Position  { return b.To }
+
+// BadExpression is a placeholder for an expression that could not be
+// parsed, so that the statement around it keeps its shape.
+type BadExpression struct {
+	From, To token.Position
+}
+
+func (b *BadExpression) expressionNode()      {}
+func (b *BadExpression) TokenLiteral() string { return "" }
+func (b *BadExpression) String() string       { return "<bad expression>" }
+func (b *BadExpression) Pos() token.Position  { return b.From }
+func (b *BadExpression) End() token.Position  { return b.To }
+
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // in source order, only set when the lexer scans comments
+}
+
+// Comment is a // or /* */ comment. Comments are not part of the statement
+// tree; the parser collects them on the Program for tools that print source.
+type Comment struct {
+	Token token.Token // the token.Comment token
 }
 
+// Text returns the comment including its delimiters.
+func (c *Comment) Text() string         { return c.Token.Literal }
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) End() token.Position  { return c.Token.End }
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
@@ -69,6 +125,22 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -86,6 +158,15 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Name == nil {
+		return ls.Token.End
+	}
+
+	return endOf(ls.Value, ls.Name.End())
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -99,6 +180,38 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ConstStatement binds Name like a LetStatement, but the binding can be
+// neither assigned to nor declared again in the same scope.
+type ConstStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ConstStatement) End() token.Position {
+	if cs.Name == nil {
+		return cs.Token.End
+	}
+
+	return endOf(cs.Value, cs.Name.End())
+}
+
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString("=")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+
+	out.WriteString(";")
+	return out.String()
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -112,67 +225,64 @@ type Bool struct {
 func (b *Bool) expressionNode()      {}
 func (b *Bool) TokenLiteral() string { return b.Token.Literal }
 func (b *Bool) String() string       { return b.Token.Literal }
+func (b *Bool) Pos() token.Position  { return b.Token.Pos }
+func (b *Bool) End() token.Position  { return b.Token.End }
 
 type GroupExpress struct {
 	Token   token.Token
 	Express Expression
+	Rparen  token.Token
 }
 
 func (g *GroupExpress) expressionNode()      {}
 func (g *GroupExpress) TokenLiteral() string { return g.Token.Literal }
 func (g *GroupExpress) String() string       { return g.Express.String() }
+func (g *GroupExpress) Pos() token.Position  { return g.Token.Pos }
+func (g *GroupExpress) End() token.Position  { return closeOf(g.Rparen, g.Express, g.Token.End) }
 
 func (id *Identifier) expressionNode()      {}
 func (id *Identifier) TokenLiteral() string { return id.Token.Literal }
 func (id *Identifier) String() string       { return id.Value }
+func (id *Identifier) Pos() token.Position  { return id.Token.Pos }
+func (id *Identifier) End() token.Position  { return id.Token.End }
 
-type IfStatement struct {
+// IfExpress is the only conditional node. It is an expression whose value is
+// the value of the branch taken, and it is also a Statement so that an
+// `else if` can be stored in ElseStatement. ElseStatement is nil, a
+// *BlockStatement or, for `else if`, another *IfExpress.
+type IfExpress struct {
 	Token         token.Token
 	Condition     Expression
-	TrueStatement Statement
-	//ElseIfStatement s
+	TrueStatement *BlockStatement
 	ElseStatement Statement
 }
 
-func (i *IfStatement) statementNode()       {}
-func (i *IfStatement) TokenLiteral() string { return i.Token.Literal }
-func (i *IfStatement) String() string {
-	var out bytes.Buffer
-	out.WriteString(" if ")
-	out.WriteString(i.Condition.String())
-	out.WriteString(i.TrueStatement.String())
+func (i *IfExpress) expressionNode()      {}
+func (i *IfExpress) statementNode()       {}
+func (i *IfExpress) TokenLiteral() string { return i.Token.Literal }
+func (i *IfExpress) Pos() token.Position  { return i.Token.Pos }
+func (i *IfExpress) End() token.Position {
 	if i.ElseStatement != nil {
-		out.WriteString(i.ElseStatement.String())
+		return i.ElseStatement.End()
 	}
 
-	return out.String()
-}
+	if i.TrueStatement != nil {
+		return i.TrueStatement.End()
+	}
 
-type IfExpress struct {
-	Token         token.Token
-	Condition     Expression
-	TrueStatement Expression
-	ElseStatement Expression
+	return endOf(i.Condition, i.Token.End)
 }
 
-func (i *IfExpress) expressionNode()      {}
-func (i *IfExpress) TokenLiteral() string { return i.Token.Literal }
 func (i *IfExpress) String() string {
 	var out bytes.Buffer
-	out.WriteString(" if ")
-
-	out.WriteString(" " + token.LPAREN + " ")
+	out.WriteString("if ")
 	out.WriteString(i.Condition.String())
-	out.WriteString(" " + token.RPAREN + " ")
-
-	out.WriteString(" " + token.LBRACE + " ")
+	out.WriteString(" ")
 	out.WriteString(i.TrueStatement.String())
-	out.WriteString(" " + token.RBRACE + " ")
-
-	out.WriteString(" " + token.Else + " ")
-	out.WriteString(" " + token.LBRACE + " ")
-	out.WriteString(i.ElseStatement.String())
-	out.WriteString(" " + token.RBRACE + " ")
+	if i.ElseStatement != nil {
+		out.WriteString(" else ")
+		out.WriteString(i.ElseStatement.String())
+	}
 
 	return out.String()
 }
@@ -180,18 +290,32 @@ func (i *IfExpress) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (g *BlockStatement) statementNode()       {}
 func (g *BlockStatement) TokenLiteral() string { return g.Token.Literal }
+func (g *BlockStatement) Pos() token.Position  { return g.Token.Pos }
+func (g *BlockStatement) End() token.Position {
+	if g.Rbrace.End.IsValid() {
+		return g.Rbrace.End
+	}
+
+	if len(g.Statements) > 0 {
+		return g.Statements[len(g.Statements)-1].End()
+	}
+
+	return g.Token.End
+}
+
 func (g *BlockStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(" { \n")
+	out.WriteString("{ ")
 	for _, stmt := range g.Statements {
 		out.WriteString(stmt.String())
 	}
 
-	out.WriteString(" } ")
+	out.WriteString(" }")
 
 	return out.String()
 }
@@ -207,6 +331,11 @@ func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
 
+func (r *ReturnStatement) Pos() token.Position { return r.Token.Pos }
+func (r *ReturnStatement) End() token.Position {
+	return endOf(r.ReturnValue, r.Token.End)
+}
+
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -220,9 +349,112 @@ func (r *ReturnStatement) String() string {
 	return out.String()
 }
 
+// WhileStatement runs Body as long as Condition is truthy.
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileStatement) statementNode()       {}
+func (w *WhileStatement) TokenLiteral() string { return w.Token.Literal }
+func (w *WhileStatement) Pos() token.Position  { return w.Token.Pos }
+func (w *WhileStatement) End() token.Position {
+	if w.Body != nil {
+		return w.Body.End()
+	}
+
+	return endOf(w.Condition, w.Token.End)
+}
+
+func (w *WhileStatement) String() string {
+	return "while " + w.Condition.String() + " " + w.Body.String()
+}
+
+// ForStatement is for Init; Condition; Post { Body }. Each of Init,
+// Condition and Post may be missing; without a condition the loop runs
+// until break or return.
+type ForStatement struct {
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (f *ForStatement) statementNode()       {}
+func (f *ForStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForStatement) End() token.Position {
+	if f.Body != nil {
+		return f.Body.End()
+	}
+
+	return f.Token.End
+}
+
+func (f *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for ")
+	if f.Init != nil {
+		out.WriteString(strings.TrimSuffix(f.Init.String(), ";"))
+	}
+
+	out.WriteString("; ")
+	if f.Condition != nil {
+		out.WriteString(f.Condition.String())
+	}
+
+	out.WriteString("; ")
+	if f.Post != nil {
+		out.WriteString(strings.TrimSuffix(f.Post.String(), ";") + " ")
+	}
+
+	out.WriteString(f.Body.String())
+	return out.String()
+}
+
+// ForInStatement runs Body once for every element of Iterable, bound to
+// Variable: the elements of an array, the keys of a hash, the characters of
+// a string or 0 up to n-1 for an integer n.
+type ForInStatement struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForInStatement) statementNode()       {}
+func (f *ForInStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForInStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForInStatement) End() token.Position {
+	if f.Body != nil {
+		return f.Body.End()
+	}
+
+	return endOf(f.Iterable, f.Token.End)
+}
+
+func (f *ForInStatement) String() string {
+	return "for " + f.Variable.String() + " in " + f.Iterable.String() + " " + f.Body.String()
+}
+
+// BranchStatement is break or continue, told apart by Token.Type.
+type BranchStatement struct {
+	Token token.Token
+}
+
+func (b *BranchStatement) statementNode()       {}
+func (b *BranchStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BranchStatement) Pos() token.Position  { return b.Token.Pos }
+func (b *BranchStatement) End() token.Position  { return b.Token.End }
+func (b *BranchStatement) String() string       { return b.Token.Literal + ";" }
+
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos }
+func (i *IntegerLiteral) End() token.Position  { return i.Token.End }
 
 type InfixExpression struct {
 	Token    token.Token
@@ -236,6 +468,9 @@ func (i *InfixExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *InfixExpression) Pos() token.Position { return posOf(i.Left, i.Token.Pos) }
+func (i *InfixExpression) End() token.Position { return endOf(i.Right, i.Token.End) }
+
 func (i *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -245,3 +480,378 @@ func (i *InfixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
+func (sl *StringLiteral) String() string       { return `"` + escapeString(sl.Value) + `"` }
+
+// ConcatExpression joins the string form of its parts. The parser produces it
+// for interpolated strings: Parts alternates between *StringLiteral for the
+// text, which may be empty, and the expressions inside ${ }, starting and
+// ending with text.
+type ConcatExpression struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (c *ConcatExpression) expressionNode()      {}
+func (c *ConcatExpression) TokenLiteral() string { return c.Token.Literal }
+func (c *ConcatExpression) Pos() token.Position  { return c.Token.Pos }
+func (c *ConcatExpression) End() token.Position {
+	if len(c.Parts) > 0 {
+		return c.Parts[len(c.Parts)-1].End()
+	}
+
+	return c.Token.End
+}
+
+func (c *ConcatExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(`"`)
+	for _, part := range c.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(escapeString(text.Value))
+			continue
+		}
+
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	out.WriteString(`"`)
+	return out.String()
+}
+
+// escapeString returns s with the characters that can't appear literally
+// between the quotes of a string replaced by escape sequences.
+func escapeString(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(ch)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				out.WriteByte('\\')
+			}
+
+			out.WriteByte(ch)
+		default:
+			out.WriteByte(ch)
+		}
+	}
+
+	return out.String()
+}
+
+type FunctionLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (f *FunctionLiteral) expressionNode()      {}
+func (f *FunctionLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FunctionLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FunctionLiteral) End() token.Position {
+	if f.Body == nil {
+		return f.Token.End
+	}
+
+	return f.Body.End()
+}
+
+func (f *FunctionLiteral) String() string {
+	var out bytes.Buffer
+	params := make([]string, 0, len(f.Parameters))
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(f.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if f.Body != nil {
+		out.WriteString(" ")
+		out.WriteString(f.Body.String())
+	}
+
+	return out.String()
+}
+
+type CallExpression struct {
+	Token     token.Token
+	Function  Expression
+	Arguments []Expression
+	Rparen    token.Token
+}
+
+func (c *CallExpression) expressionNode()      {}
+func (c *CallExpression) TokenLiteral() string { return c.Token.Literal }
+func (c *CallExpression) Pos() token.Position  { return posOf(c.Function, c.Token.Pos) }
+func (c *CallExpression) End() token.Position {
+	if len(c.Arguments) > 0 {
+		return closeOf(c.Rparen, c.Arguments[len(c.Arguments)-1], c.Token.End)
+	}
+
+	return closeOf(c.Rparen, nil, c.Token.End)
+}
+
+func (c *CallExpression) String() string {
+	var out bytes.Buffer
+	args := make([]string, 0, len(c.Arguments))
+	for _, a := range c.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(c.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // the [ token
+	Elements []Expression
+	Rbracket token.Token
+}
+
+func (a *ArrayLiteral) expressionNode()      {}
+func (a *ArrayLiteral) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayLiteral) Pos() token.Position  { return a.Token.Pos }
+func (a *ArrayLiteral) End() token.Position {
+	if len(a.Elements) > 0 {
+		return closeOf(a.Rbracket, a.Elements[len(a.Elements)-1], a.Token.End)
+	}
+
+	return closeOf(a.Rbracket, nil, a.Token.End)
+}
+
+func (a *ArrayLiteral) String() string {
+	elements := make([]string, 0, len(a.Elements))
+	for _, e := range a.Elements {
+		elements = append(elements, e.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// AssignExpression is Target = Value or a compound assignment such as
+// Target += Value. Target is an *Identifier or an *IndexExpression.
+type AssignExpression struct {
+	Token    token.Token // the assignment operator
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (a *AssignExpression) expressionNode()      {}
+func (a *AssignExpression) TokenLiteral() string { return a.Token.Literal }
+func (a *AssignExpression) Pos() token.Position  { return posOf(a.Target, a.Token.Pos) }
+func (a *AssignExpression) End() token.Position  { return endOf(a.Value, a.Token.End) }
+func (a *AssignExpression) String() string {
+	return "(" + a.Target.String() + " " + a.Operator + " " + a.Value.String() + ")"
+}
+
+// HashLiteral is {key: value, ...}. Pairs keep the source order.
+type HashLiteral struct {
+	Token  token.Token // the { token
+	Pairs  []HashPair
+	Rbrace token.Token
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (h *HashLiteral) expressionNode()      {}
+func (h *HashLiteral) TokenLiteral() string { return h.Token.Literal }
+func (h *HashLiteral) Pos() token.Position  { return h.Token.Pos }
+func (h *HashLiteral) End() token.Position {
+	if len(h.Pairs) > 0 {
+		return closeOf(h.Rbrace, h.Pairs[len(h.Pairs)-1].Value, h.Token.End)
+	}
+
+	return closeOf(h.Rbrace, nil, h.Token.End)
+}
+
+func (h *HashLiteral) String() string {
+	pairs := make([]string, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// IndexExpression is Left[Index].
+type IndexExpression struct {
+	Token    token.Token // the [ token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
+}
+
+func (i *IndexExpression) expressionNode()      {}
+func (i *IndexExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IndexExpression) Pos() token.Position  { return posOf(i.Left, i.Token.Pos) }
+func (i *IndexExpression) End() token.Position {
+	return closeOf(i.Rbracket, i.Index, i.Token.End)
+}
+
+func (i *IndexExpression) String() string {
+	return "(" + i.Left.String() + "[" + i.Index.String() + "])"
+}
+
+// SliceExpression is Left[Low:High]. Low and High are optional and default
+// to the start and the end of Left.
+type SliceExpression struct {
+	Token    token.Token // the [ token
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token
+}
+
+func (s *SliceExpression) expressionNode()      {}
+func (s *SliceExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SliceExpression) Pos() token.Position  { return posOf(s.Left, s.Token.Pos) }
+func (s *SliceExpression) End() token.Position {
+	if s.High != nil {
+		return closeOf(s.Rbracket, s.High, s.Token.End)
+	}
+
+	return closeOf(s.Rbracket, s.Low, s.Token.End)
+}
+
+func (s *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(" + s.Left.String() + "[")
+	if s.Low != nil {
+		out.WriteString(s.Low.String())
+	}
+
+	out.WriteString(":")
+	if s.High != nil {
+		out.WriteString(s.High.String())
+	}
+
+	out.WriteString("])")
+	return out.String()
+}
+
+// SwitchExpression evaluates the body of the first case with a value equal to
+// Value, or Default when no case matches. Without a Value the first case with
+// a truthy value is taken. There is no fallthrough.
+type SwitchExpression struct {
+	Token   token.Token
+	Value   Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement
+	Rbrace  token.Token
+}
+
+func (s *SwitchExpression) expressionNode()      {}
+func (s *SwitchExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SwitchExpression) Pos() token.Position  { return s.Token.Pos }
+func (s *SwitchExpression) End() token.Position  { return closeOf(s.Rbrace, s.Value, s.Token.End) }
+func (s *SwitchExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("switch ")
+	if s.Value != nil {
+		out.WriteString(s.Value.String())
+		out.WriteString(" ")
+	}
+
+	out.WriteString("{ ")
+	for _, c := range s.Cases {
+		out.WriteString(c.String())
+		out.WriteString(" ")
+	}
+
+	if s.Default != nil {
+		out.WriteString("default ")
+		out.WriteString(s.Default.String())
+		out.WriteString(" ")
+	}
+
+	out.WriteString("}")
+	return out.String()
+}
+
+// SwitchCase is one `case a, b { }` clause of a SwitchExpression.
+type SwitchCase struct {
+	Token  token.Token
+	Values []Expression
+	Body   *BlockStatement
+}
+
+func (c *SwitchCase) TokenLiteral() string { return c.Token.Literal }
+func (c *SwitchCase) Pos() token.Position  { return c.Token.Pos }
+func (c *SwitchCase) End() token.Position {
+	if c.Body == nil {
+		return c.Token.End
+	}
+
+	return c.Body.End()
+}
+
+func (c *SwitchCase) String() string {
+	var out bytes.Buffer
+	values := make([]string, 0, len(c.Values))
+	for _, v := range c.Values {
+		values = append(values, v.String())
+	}
+
+	out.WriteString("case ")
+	out.WriteString(strings.Join(values, ", "))
+	out.WriteString(" ")
+	out.WriteString(c.Body.String())
+	return out.String()
+}
+
+// posOf returns the start of n, or fallback when the parser left n empty.
+func posOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+
+	return n.Pos()
+}
+
+// endOf returns the end of n, or fallback when the parser left n empty.
+func endOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+
+	return n.End()
+}
+
+// closeOf returns the end of the closing token tok, falling back to the end
+// of the last child n when the closing token is missing.
+func closeOf(tok token.Token, n Node, fallback token.Position) token.Position {
+	if tok.End.IsValid() {
+		return tok.End
+	}
+
+	return endOf(n, fallback)
+}
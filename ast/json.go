@@ -0,0 +1,341 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/abusizhishen/zlang/token"
+)
+
+// kinds maps the kind of a node in JSON, the name of its type, to the type.
+var kinds = make(map[string]reflect.Type)
+
+func init() {
+	for _, n := range []Node{
+		&Program{}, &Comment{}, &BadStatement{}, &BadExpression{},
+		&ExpressionStatement{}, &LetStatement{}, &ConstStatement{}, &ReturnStatement{},
+		&BlockStatement{}, &WhileStatement{}, &ForStatement{}, &ForInStatement{}, &BranchStatement{},
+		&Identifier{}, &IntegerLiteral{}, &FloatLiteral{}, &StringLiteral{}, &Bool{},
+		&PrefixExpression{}, &InfixExpression{}, &GroupExpress{}, &IfExpress{},
+		&ConcatExpression{}, &FunctionLiteral{}, &CallExpression{}, &ArrayLiteral{},
+		&HashLiteral{}, &IndexExpression{}, &SliceExpression{}, &AssignExpression{},
+		&SwitchExpression{}, &SwitchCase{},
+	} {
+		t := reflect.TypeOf(n).Elem()
+		kinds[t.Name()] = t
+	}
+}
+
+// required lists the children a node can't do without, by kind. Decoding
+// fails when one of them is missing.
+var required = map[string][]string{
+	"ExpressionStatement": {"Expression"},
+	"LetStatement":        {"Name", "Value"},
+	"ConstStatement":      {"Name", "Value"},
+	"WhileStatement":      {"Condition", "Body"},
+	"ForStatement":        {"Body"},
+	"ForInStatement":      {"Variable", "Iterable", "Body"},
+	"PrefixExpression":    {"Right"},
+	"InfixExpression":     {"Left", "Right"},
+	"GroupExpress":        {"Express"},
+	"IfExpress":           {"Condition", "TrueStatement"},
+	"FunctionLiteral":     {"Body"},
+	"CallExpression":      {"Function"},
+	"HashPair":            {"Key", "Value"},
+	"IndexExpression":     {"Left", "Index"},
+	"SliceExpression":     {"Left"},
+	"AssignExpression":    {"Target", "Value"},
+	"SwitchCase":          {"Body"},
+}
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+)
+
+// MarshalJSON encodes the tree rooted at node as JSON. Every node becomes an
+// object with its "kind", the name of its type, its "pos" and "end" and its
+// fields under their Go names: child nodes as objects, lists as arrays,
+// tokens as objects with type, literal, pos and end, and missing children as
+// null. "pos" and "end" are informational; UnmarshalJSON ignores them.
+func MarshalJSON(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		if v.Kind() == reflect.Interface {
+			return encodeValue(buf, v.Elem())
+		}
+
+		node, ok := v.Interface().(Node)
+		if !ok {
+			return fmt.Errorf("ast: cannot encode %s", v.Type())
+		}
+
+		if _, ok := kinds[v.Elem().Type().Name()]; !ok {
+			return fmt.Errorf("ast: cannot encode node type %s", v.Type())
+		}
+
+		buf.WriteString(`{"kind":`)
+		if err := encodeJSON(buf, v.Elem().Type().Name()); err != nil {
+			return err
+		}
+
+		buf.WriteString(`,"pos":`)
+		if err := encodeJSON(buf, node.Pos()); err != nil {
+			return err
+		}
+
+		buf.WriteString(`,"end":`)
+		if err := encodeJSON(buf, node.End()); err != nil {
+			return err
+		}
+
+		return encodeFields(buf, v.Elem(), false)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+		return nil
+
+	case reflect.Struct:
+		if v.Type() != tokenType && v.Type() != positionType {
+			buf.WriteByte('{')
+			return encodeFields(buf, v, true)
+		}
+	}
+
+	return encodeJSON(buf, v.Interface())
+}
+
+// encodeFields writes the fields of the struct v and the closing brace of
+// its object, after an opening brace when first is set and after the kind,
+// pos and end of a node otherwise.
+func encodeFields(buf *bytes.Buffer, v reflect.Value, first bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		if !first {
+			buf.WriteByte(',')
+		}
+
+		first = false
+		if err := encodeJSON(buf, v.Type().Field(i).Name); err != nil {
+			return err
+		}
+
+		buf.WriteByte(':')
+		if err := encodeValue(buf, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteByte('}')
+	return nil
+}
+
+func encodeJSON(buf *bytes.Buffer, x interface{}) error {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false) // keep the < and > of operators and "<stdin>"
+	if err := enc.Encode(x); err != nil {
+		return fmt.Errorf("ast: %v", err)
+	}
+
+	buf.Write(bytes.TrimSuffix(out.Bytes(), []byte("\n")))
+	return nil
+}
+
+// UnmarshalJSON decodes a node encoded by MarshalJSON. Fields left out of an
+// object keep their zero value, so tools may leave out tokens and positions.
+// Unknown kinds and fields are errors, as are missing children a node can't
+// do without, such as the operands of an infix expression, and null elements
+// of lists.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var node Node
+	if err := decodeValue(data, reflect.ValueOf(&node).Elem(), "node"); err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("ast: no node in JSON")
+	}
+
+	return node, nil
+}
+
+// UnmarshalProgram decodes a Program encoded by MarshalJSON.
+func UnmarshalProgram(data []byte) (*Program, error) {
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected a Program, got %T", node)
+	}
+
+	return program, nil
+}
+
+// decodeValue decodes data into v, which must be settable. where names v in
+// error messages.
+func decodeValue(data json.RawMessage, v reflect.Value, where string) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.Kind() == reflect.Ptr && !v.Type().Implements(nodeType) {
+			break
+		}
+
+		node, err := decodeNode(data)
+		if err != nil {
+			return err
+		}
+
+		nv := reflect.ValueOf(node)
+		if !nv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("ast: %s: cannot use %s as %s", where, nv.Elem().Type().Name(), typeName(v.Type()))
+		}
+
+		v.Set(nv)
+		return nil
+
+	case reflect.Slice:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("ast: %s: %v", where, err)
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		for i, elem := range list {
+			where := fmt.Sprintf("%s[%d]", where, i)
+			if err := decodeValue(elem, v.Index(i), where); err != nil {
+				return err
+			}
+
+			if e := v.Index(i); (e.Kind() == reflect.Interface || e.Kind() == reflect.Ptr) && e.IsNil() {
+				return fmt.Errorf("ast: %s is missing", where)
+			}
+		}
+
+		return nil
+
+	case reflect.Struct:
+		if v.Type() != tokenType && v.Type() != positionType {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				return fmt.Errorf("ast: %s: %v", where, err)
+			}
+
+			return decodeFields(fields, v)
+		}
+	}
+
+	if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+		return fmt.Errorf("ast: %s: %v", where, err)
+	}
+
+	return nil
+}
+
+func decodeNode(data json.RawMessage) (Node, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ast: node: %v", err)
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil || kind == "" {
+		return nil, fmt.Errorf("ast: node without kind")
+	}
+
+	t, ok := kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("ast: unknown node kind %q", kind)
+	}
+
+	delete(fields, "kind")
+	delete(fields, "pos")
+	delete(fields, "end")
+
+	node := reflect.New(t)
+	if err := decodeFields(fields, node.Elem()); err != nil {
+		return nil, err
+	}
+
+	return node.Interface().(Node), nil
+}
+
+func decodeFields(fields map[string]json.RawMessage, v reflect.Value) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		f, ok := v.Type().FieldByName(name)
+		if !ok || !f.IsExported() {
+			return fmt.Errorf("ast: unknown field %s in %s", name, v.Type().Name())
+		}
+
+		if err := decodeValue(fields[name], v.FieldByIndex(f.Index), v.Type().Name()+"."+name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range required[v.Type().Name()] {
+		if v.FieldByName(name).IsNil() {
+			return fmt.Errorf("ast: %s.%s is missing", v.Type().Name(), name)
+		}
+	}
+
+	return nil
+}
+
+// typeName returns the name of t for error messages, such as Expression or
+// *Identifier.
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	}
+
+	return t.Name()
+}
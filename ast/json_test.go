@@ -0,0 +1,204 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/format"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+)
+
+// fill sets the missing children of the node n to placeholders, so that it
+// passes the checks of UnmarshalJSON.
+func fill(n ast.Node) ast.Node {
+	n = ast.Clone(n)
+	v := reflect.ValueOf(n).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if (f.Kind() != reflect.Interface && f.Kind() != reflect.Ptr) || !f.IsNil() {
+			continue
+		}
+
+		for _, child := range []ast.Node{
+			&ast.Identifier{Value: "x"},
+			&ast.BlockStatement{},
+			&ast.BranchStatement{},
+		} {
+			if reflect.TypeOf(child).AssignableTo(f.Type()) {
+				f.Set(reflect.ValueOf(child))
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+func TestJSONCoversAllNodes(t *testing.T) {
+	for _, n := range nodes {
+		n = fill(n)
+		data, err := ast.MarshalJSON(n)
+		if err != nil {
+			t.Errorf("MarshalJSON(%T) failed: %v", n, err)
+			continue
+		}
+
+		decoded, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Errorf("UnmarshalJSON(%s) failed: %v", data, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(decoded, n) {
+			t.Errorf("%T does not survive JSON. got=%#v", n, decoded)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	l := lexer.New("// comment\n" + everything)
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+
+	if !json.Valid(data) {
+		t.Fatalf("MarshalJSON produced invalid JSON: %s", data)
+	}
+
+	decoded, err := ast.UnmarshalProgram(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProgram failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("program does not survive JSON.\nexpected=%s\ngot=     %s", program, decoded)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	program := parse(t, "-x")
+	data, err := ast.MarshalJSON(program.Statements[0])
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+
+	expected := `{"kind":"ExpressionStatement","pos":{"offset":0,"line":1,"column":1},"end":{"offset":2,"line":1,"column":3},` +
+		`"Token":{"type":"-","literal":"-","pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}},` +
+		`"Expression":{"kind":"PrefixExpression","pos":{"offset":0,"line":1,"column":1},"end":{"offset":2,"line":1,"column":3},` +
+		`"Token":{"type":"-","literal":"-","pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}},` +
+		`"Operator":"-",` +
+		`"Right":{"kind":"Identifier","pos":{"offset":1,"line":1,"column":2},"end":{"offset":2,"line":1,"column":3},` +
+		`"Token":{"type":"IDENTIFIER","literal":"x","pos":{"offset":1,"line":1,"column":2},"end":{"offset":2,"line":1,"column":3}},"Value":"x"}}}`
+	if string(data) != expected {
+		t.Errorf("MarshalJSON wrong.\nexpected=%s\ngot=     %s", expected, data)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	// what a generator in another language might write: no tokens, no positions
+	input := `{"kind": "Program", "Statements": [
+		{"kind": "LetStatement", "Name": {"kind": "Identifier", "Value": "a"},
+		 "Value": {"kind": "InfixExpression", "Operator": "+",
+		           "Left": {"kind": "IntegerLiteral", "Value": 1},
+		           "Right": {"kind": "Identifier", "Value": "b"}}},
+		{"kind": "ExpressionStatement", "Expression": {"kind": "ArrayLiteral", "Elements": [
+			{"kind": "StringLiteral", "Value": "x"}, {"kind": "Bool", "Value": true}]}}
+	]}`
+
+	program, err := ast.UnmarshalProgram([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalProgram failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, program); err != nil {
+		t.Fatalf("format.Node failed: %v", err)
+	}
+
+	if buf.String() != "let a = 1 + b\n[\"x\", true]\n" {
+		t.Errorf("program wrong. got=%q", buf.String())
+	}
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"Statements": []}`, "node without kind"},
+		{`{"kind": "Loop"}`, `unknown node kind "Loop"`},
+		{`{"kind": "Identifier", "Name": "a"}`, "unknown field Name in Identifier"},
+		{`{"kind": "LetStatement", "Name": {"kind": "IntegerLiteral"}}`, "LetStatement.Name: cannot use IntegerLiteral as *Identifier"},
+		{`{"kind": "ExpressionStatement", "Expression": {"kind": "BranchStatement"}}`, "cannot use BranchStatement as Expression"},
+		{`{"kind": "ExpressionStatement"}`, "ExpressionStatement.Expression is missing"},
+		{`{"kind": "LetStatement", "Name": {"kind": "Identifier"}, "Value": null}`, "LetStatement.Value is missing"},
+		{`{"kind": "InfixExpression", "Left": {"kind": "Identifier"}}`, "InfixExpression.Right is missing"},
+		{`{"kind": "HashLiteral", "Pairs": [{"Key": {"kind": "Identifier"}}]}`, "HashPair.Value is missing"},
+		{`{"kind": "Program", "Statements": [null]}`, "Program.Statements[0] is missing"},
+		{`{"kind": "IntegerLiteral", "Value": "1"}`, "IntegerLiteral.Value: json"},
+		{`null`, "no node"},
+		{`{"kind": "Identifier"}`, "expected a Program, got *ast.Identifier"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.UnmarshalProgram([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error containing %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestFprint(t *testing.T) {
+	program := parse(t, "let a = f(1, \"s\") + 2.5\nfor x in [true] { break }")
+
+	var buf bytes.Buffer
+	if err := ast.Fprint(&buf, program); err != nil {
+		t.Fatalf("Fprint failed: %v", err)
+	}
+
+	expected := `(Program
+  Statements: (LetStatement
+    Name: (Identifier "a")
+    Value: (InfixExpression "+"
+      Left: (CallExpression
+        Function: (Identifier "f")
+        Arguments: (IntegerLiteral 1)
+        Arguments: (StringLiteral "s"))
+      Right: (FloatLiteral 2.5)))
+  Statements: (ForInStatement
+    Variable: (Identifier "x")
+    Iterable: (ArrayLiteral
+      Elements: (Bool true))
+    Body: (BlockStatement
+      Statements: (BranchStatement "break"))))
+`
+	if buf.String() != expected {
+		t.Errorf("Fprint wrong.\nexpected=\n%s\ngot=\n%s", expected, buf.String())
+	}
+
+	if got := ast.Sprint(nil); got != "nil" {
+		t.Errorf("Sprint(nil) wrong. got=%q", got)
+	}
+
+	var ident *ast.Identifier
+	buf.Reset()
+	if err := ast.Fprint(&buf, ident); err != nil || buf.String() != "nil\n" {
+		t.Errorf("Fprint of a nil node wrong. got=%q, %v", buf.String(), err)
+	}
+
+	hash := parse(t, `{"k": 1}`).Statements[0].(*ast.ExpressionStatement).Expression
+	if got := ast.Sprint(hash); got != "(HashLiteral\n  Pairs: (HashPair\n    Key: (StringLiteral \"k\")\n    Value: (IntegerLiteral 1)))" {
+		t.Errorf("Sprint wrong. got=%q", got)
+	}
+}
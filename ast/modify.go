@@ -0,0 +1,492 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the replacement for node, node itself to keep it or
+// nil to remove it.
+type ModifierFunc func(node Node) Node
+
+// Modify rewrites the tree rooted at node bottom-up: the children of a node
+// are modified before modifier is called with the node itself, and the
+// result of modifier replaces the node in its parent. Modify works in place;
+// Clone the tree first to keep the original.
+//
+// A nil result clears an optional field, such as the value of a return
+// statement, and drops the element from a list, such as a statement of a
+// block. A replacement must fit the field it is stored in: an Expression
+// for an expression, a *BlockStatement for a body and so on. Modify panics
+// otherwise.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	// Leaves
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Bool,
+		*BranchStatement, *Comment, *BadStatement, *BadExpression:
+		// nothing to do
+
+	// Expressions
+	case *PrefixExpression:
+		n.Right = modifyExpr(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modifyExpr(n.Left, modifier)
+		n.Right = modifyExpr(n.Right, modifier)
+
+	case *GroupExpress:
+		n.Express = modifyExpr(n.Express, modifier)
+
+	case *IfExpress:
+		n.Condition = modifyExpr(n.Condition, modifier)
+		n.TrueStatement = modifyBlock(n.TrueStatement, modifier)
+		n.ElseStatement = modifyStmt(n.ElseStatement, modifier)
+
+	case *ConcatExpression:
+		n.Parts = modifyExprList(n.Parts, modifier)
+
+	case *FunctionLiteral:
+		params := n.Parameters[:0]
+		for _, param := range n.Parameters {
+			if param = modifyIdent(param, modifier); param != nil {
+				params = append(params, param)
+			}
+		}
+
+		n.Parameters = params
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *CallExpression:
+		n.Function = modifyExpr(n.Function, modifier)
+		n.Arguments = modifyExprList(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		n.Elements = modifyExprList(n.Elements, modifier)
+
+	case *HashLiteral:
+		pairs := n.Pairs[:0]
+		for _, pair := range n.Pairs {
+			pair.Key = modifyExpr(pair.Key, modifier)
+			pair.Value = modifyExpr(pair.Value, modifier)
+			if pair.Key != nil && pair.Value != nil {
+				pairs = append(pairs, pair)
+			}
+		}
+
+		n.Pairs = pairs
+
+	case *IndexExpression:
+		n.Left = modifyExpr(n.Left, modifier)
+		n.Index = modifyExpr(n.Index, modifier)
+
+	case *SliceExpression:
+		n.Left = modifyExpr(n.Left, modifier)
+		n.Low = modifyExpr(n.Low, modifier)
+		n.High = modifyExpr(n.High, modifier)
+
+	case *AssignExpression:
+		n.Target = modifyExpr(n.Target, modifier)
+		n.Value = modifyExpr(n.Value, modifier)
+
+	case *SwitchExpression:
+		n.Value = modifyExpr(n.Value, modifier)
+		cases := n.Cases[:0]
+		for _, c := range n.Cases {
+			if c == nil {
+				continue
+			}
+
+			if c = modifyNode[*SwitchCase](c, modifier); c != nil {
+				cases = append(cases, c)
+			}
+		}
+
+		n.Cases = cases
+		n.Default = modifyBlock(n.Default, modifier)
+
+	case *SwitchCase:
+		n.Values = modifyExprList(n.Values, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	// Statements
+	case *ExpressionStatement:
+		n.Expression = modifyExpr(n.Expression, modifier)
+
+	case *LetStatement:
+		n.Name = modifyIdent(n.Name, modifier)
+		n.Value = modifyExpr(n.Value, modifier)
+
+	case *ConstStatement:
+		n.Name = modifyIdent(n.Name, modifier)
+		n.Value = modifyExpr(n.Value, modifier)
+
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpr(n.ReturnValue, modifier)
+
+	case *BlockStatement:
+		n.Statements = modifyStmtList(n.Statements, modifier)
+
+	case *WhileStatement:
+		n.Condition = modifyExpr(n.Condition, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *ForStatement:
+		n.Init = modifyStmt(n.Init, modifier)
+		n.Condition = modifyExpr(n.Condition, modifier)
+		n.Post = modifyStmt(n.Post, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *ForInStatement:
+		n.Variable = modifyIdent(n.Variable, modifier)
+		n.Iterable = modifyExpr(n.Iterable, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *Program:
+		n.Statements = modifyStmtList(n.Statements, modifier)
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+// modifyNode modifies the child n and checks that its replacement is a T.
+// n must not be nil; a nil replacement is returned as the zero T so that no
+// typed nil ends up in an interface field.
+func modifyNode[T Node](n T, modifier ModifierFunc) T {
+	var zero T
+	res := Modify(n, modifier)
+	if res == nil {
+		return zero
+	}
+
+	t, ok := res.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: cannot replace %T with %T", n, res))
+	}
+
+	return t
+}
+
+func modifyExpr(x Expression, modifier ModifierFunc) Expression {
+	if x == nil {
+		return nil
+	}
+
+	return modifyNode(x, modifier)
+}
+
+func modifyStmt(s Statement, modifier ModifierFunc) Statement {
+	if s == nil {
+		return nil
+	}
+
+	return modifyNode(s, modifier)
+}
+
+func modifyIdent(id *Identifier, modifier ModifierFunc) *Identifier {
+	if id == nil {
+		return nil
+	}
+
+	return modifyNode(id, modifier)
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	return modifyNode(b, modifier)
+}
+
+func modifyExprList(list []Expression, modifier ModifierFunc) []Expression {
+	res := list[:0]
+	for _, x := range list {
+		if x = modifyExpr(x, modifier); x != nil {
+			res = append(res, x)
+		}
+	}
+
+	return res
+}
+
+func modifyStmtList(list []Statement, modifier ModifierFunc) []Statement {
+	res := list[:0]
+	for _, s := range list {
+		if s = modifyStmt(s, modifier); s != nil {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// Clone returns a deep copy of the tree rooted at node that shares no nodes,
+// slices or pointers with the original. Clone(nil) is nil.
+func Clone(node Node) Node {
+	switch n := node.(type) {
+	case nil:
+		return nil
+
+	// Leaves
+	case *Identifier:
+		return cloneIdent(n)
+	case *IntegerLiteral:
+		c := *n
+		return &c
+	case *FloatLiteral:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *Bool:
+		c := *n
+		return &c
+	case *BranchStatement:
+		c := *n
+		return &c
+	case *Comment:
+		return cloneComment(n)
+	case *BadStatement:
+		c := *n
+		return &c
+	case *BadExpression:
+		c := *n
+		return &c
+
+	// Expressions
+	case *PrefixExpression:
+		c := *n
+		c.Right = cloneExpr(n.Right)
+		return &c
+
+	case *InfixExpression:
+		c := *n
+		c.Left = cloneExpr(n.Left)
+		c.Right = cloneExpr(n.Right)
+		return &c
+
+	case *GroupExpress:
+		c := *n
+		c.Express = cloneExpr(n.Express)
+		return &c
+
+	case *IfExpress:
+		c := *n
+		c.Condition = cloneExpr(n.Condition)
+		c.TrueStatement = cloneBlock(n.TrueStatement)
+		c.ElseStatement = cloneStmt(n.ElseStatement)
+		return &c
+
+	case *ConcatExpression:
+		c := *n
+		c.Parts = cloneExprList(n.Parts)
+		return &c
+
+	case *FunctionLiteral:
+		c := *n
+		if n.Parameters != nil {
+			c.Parameters = make([]*Identifier, len(n.Parameters))
+			for i, param := range n.Parameters {
+				c.Parameters[i] = cloneIdent(param)
+			}
+		}
+
+		c.Body = cloneBlock(n.Body)
+		return &c
+
+	case *CallExpression:
+		c := *n
+		c.Function = cloneExpr(n.Function)
+		c.Arguments = cloneExprList(n.Arguments)
+		return &c
+
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = cloneExprList(n.Elements)
+		return &c
+
+	case *HashLiteral:
+		c := *n
+		if n.Pairs != nil {
+			c.Pairs = make([]HashPair, len(n.Pairs))
+			for i, pair := range n.Pairs {
+				c.Pairs[i] = HashPair{Key: cloneExpr(pair.Key), Value: cloneExpr(pair.Value)}
+			}
+		}
+
+		return &c
+
+	case *IndexExpression:
+		c := *n
+		c.Left = cloneExpr(n.Left)
+		c.Index = cloneExpr(n.Index)
+		return &c
+
+	case *SliceExpression:
+		c := *n
+		c.Left = cloneExpr(n.Left)
+		c.Low = cloneExpr(n.Low)
+		c.High = cloneExpr(n.High)
+		return &c
+
+	case *AssignExpression:
+		c := *n
+		c.Target = cloneExpr(n.Target)
+		c.Value = cloneExpr(n.Value)
+		return &c
+
+	case *SwitchExpression:
+		c := *n
+		c.Value = cloneExpr(n.Value)
+		if n.Cases != nil {
+			c.Cases = make([]*SwitchCase, len(n.Cases))
+			for i, sc := range n.Cases {
+				if sc != nil {
+					c.Cases[i] = Clone(sc).(*SwitchCase)
+				}
+			}
+		}
+
+		c.Default = cloneBlock(n.Default)
+		return &c
+
+	case *SwitchCase:
+		c := *n
+		c.Values = cloneExprList(n.Values)
+		c.Body = cloneBlock(n.Body)
+		return &c
+
+	// Statements
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = cloneExpr(n.Expression)
+		return &c
+
+	case *LetStatement:
+		c := *n
+		c.Name = cloneIdent(n.Name)
+		c.Value = cloneExpr(n.Value)
+		return &c
+
+	case *ConstStatement:
+		c := *n
+		c.Name = cloneIdent(n.Name)
+		c.Value = cloneExpr(n.Value)
+		return &c
+
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = cloneExpr(n.ReturnValue)
+		return &c
+
+	case *BlockStatement:
+		return cloneBlock(n)
+
+	case *WhileStatement:
+		c := *n
+		c.Condition = cloneExpr(n.Condition)
+		c.Body = cloneBlock(n.Body)
+		return &c
+
+	case *ForStatement:
+		c := *n
+		c.Init = cloneStmt(n.Init)
+		c.Condition = cloneExpr(n.Condition)
+		c.Post = cloneStmt(n.Post)
+		c.Body = cloneBlock(n.Body)
+		return &c
+
+	case *ForInStatement:
+		c := *n
+		c.Variable = cloneIdent(n.Variable)
+		c.Iterable = cloneExpr(n.Iterable)
+		c.Body = cloneBlock(n.Body)
+		return &c
+
+	case *Program:
+		c := *n
+		c.Statements = cloneStmtList(n.Statements)
+		if n.Comments != nil {
+			c.Comments = make([]*Comment, len(n.Comments))
+			for i, comment := range n.Comments {
+				c.Comments[i] = cloneComment(comment)
+			}
+		}
+
+		return &c
+
+	default:
+		panic(fmt.Sprintf("ast.Clone: unexpected node type %T", n))
+	}
+}
+
+func cloneExpr(x Expression) Expression {
+	if x == nil {
+		return nil
+	}
+
+	return Clone(x).(Expression)
+}
+
+func cloneStmt(s Statement) Statement {
+	if s == nil {
+		return nil
+	}
+
+	return Clone(s).(Statement)
+}
+
+func cloneIdent(id *Identifier) *Identifier {
+	if id == nil {
+		return nil
+	}
+
+	c := *id
+	return &c
+}
+
+func cloneComment(comment *Comment) *Comment {
+	if comment == nil {
+		return nil
+	}
+
+	c := *comment
+	return &c
+}
+
+func cloneBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	c := *b
+	c.Statements = cloneStmtList(b.Statements)
+	return &c
+}
+
+func cloneExprList(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+
+	c := make([]Expression, len(list))
+	for i, x := range list {
+		c[i] = cloneExpr(x)
+	}
+
+	return c
+}
+
+func cloneStmtList(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+
+	c := make([]Statement, len(list))
+	for i, s := range list {
+		c[i] = cloneStmt(s)
+	}
+
+	return c
+}
@@ -0,0 +1,223 @@
+package ast_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+	"github.com/abusizhishen/zlang/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
+
+// everything uses every node type the parser produces.
+const everything = `let a = -1 + 2 * 3.5
+const s = "x${a}y"
+let f = fun(x, y) { return x[0:1] }
+let h = {"k": [1, true], 2: (a)}
+if (a < 2) { a += 1 } else if a { f(a, h) } else { a }
+switch a { case 1, 2 { a } default { h["k"][0] = 3 } }
+while a { break }
+for let i = 0; i < 3; i = i + 1 { continue }
+for v in h { v }
+return`
+
+func TestModify(t *testing.T) {
+	one := func() ast.Expression { return &ast.IntegerLiteral{Value: 1, Token: tokenLiteral("1")} }
+	two := func() ast.Expression { return &ast.IntegerLiteral{Value: 2, Token: tokenLiteral("2")} }
+
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		return two()
+	}
+
+	tests := []struct {
+		input    ast.Node
+		expected ast.Node
+	}{
+		{one(), two()},
+		{
+			&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+			&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&ast.InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&ast.InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&ast.PrefixExpression{Operator: "-", Right: one()},
+			&ast.PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&ast.IndexExpression{Left: one(), Index: one()},
+			&ast.IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&ast.IfExpress{
+				Condition:     one(),
+				TrueStatement: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+				ElseStatement: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+			},
+			&ast.IfExpress{
+				Condition:     two(),
+				TrueStatement: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: two()}}},
+				ElseStatement: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&ast.ReturnStatement{ReturnValue: one()},
+			&ast.ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&ast.LetStatement{Value: one()},
+			&ast.LetStatement{Value: two()},
+		},
+		{
+			&ast.FunctionLiteral{Parameters: []*ast.Identifier{}, Body: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}}},
+			&ast.FunctionLiteral{Parameters: []*ast.Identifier{}, Body: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: two()}}}},
+		},
+		{
+			&ast.ArrayLiteral{Elements: []ast.Expression{one(), one()}},
+			&ast.ArrayLiteral{Elements: []ast.Expression{two(), two()}},
+		},
+		{
+			&ast.HashLiteral{Pairs: []ast.HashPair{{Key: one(), Value: one()}}},
+			&ast.HashLiteral{Pairs: []ast.HashPair{{Key: two(), Value: two()}}},
+		},
+		{
+			&ast.ForStatement{Condition: one(), Body: &ast.BlockStatement{}},
+			&ast.ForStatement{Condition: two(), Body: &ast.BlockStatement{}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := ast.Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func tokenLiteral(lit string) token.Token {
+	return token.Token{Type: token.Integer, Literal: lit}
+}
+
+func TestModifyRemovesNodes(t *testing.T) {
+	program := parse(t, "let b = 1; a; fun(x) { return a }; [1, a, 2]")
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.ExpressionStatement:
+			if id, ok := node.Expression.(*ast.Identifier); ok && id.Value == "a" {
+				return nil
+			}
+		case *ast.Identifier:
+			if node.Value == "a" {
+				return nil
+			}
+		}
+
+		return node
+	})
+
+	expected := "let b=1;fun(x) { return ; }[1, 2]"
+	if program.String() != expected {
+		t.Errorf("program wrong. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestModifyPanicsOnMismatch(t *testing.T) {
+	program := parse(t, "let a = 1")
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), "cannot replace *ast.IntegerLiteral with *ast.BlockStatement") {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.IntegerLiteral); ok {
+			return &ast.BlockStatement{}
+		}
+
+		return node
+	})
+}
+
+func TestCloneCoversAllNodes(t *testing.T) {
+	for _, n := range nodes {
+		c := ast.Clone(n)
+		if !reflect.DeepEqual(c, n) {
+			t.Errorf("clone of %T differs. got=%#v", n, c)
+		}
+
+		if ast.Modify(c, func(n ast.Node) ast.Node { return n }) != c {
+			t.Errorf("Modify does not return %T", n)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	program := parse(t, everything)
+	original := program.String()
+
+	clone := ast.Clone(program).(*ast.Program)
+	if !reflect.DeepEqual(clone, program) {
+		t.Fatalf("clone differs from the original")
+	}
+
+	seen := make(map[ast.Node]bool)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			seen[n] = true
+		}
+
+		return true
+	})
+
+	ast.Inspect(clone, func(n ast.Node) bool {
+		if n != nil && seen[n] {
+			t.Errorf("clone shares %T %s with the original", n, n)
+		}
+
+		return true
+	})
+
+	ast.Modify(clone, func(node ast.Node) ast.Node {
+		if id, ok := node.(*ast.Identifier); ok {
+			id.Value = strings.ToUpper(id.Value)
+		}
+
+		return node
+	})
+
+	if program.String() != original {
+		t.Errorf("modifying the clone changed the original.\nexpected=%s\ngot=     %s", original, program.String())
+	}
+
+	if clone.String() == original {
+		t.Errorf("clone was not modified")
+	}
+
+	if ast.Clone(nil) != nil {
+		t.Errorf("Clone(nil) is not nil")
+	}
+}
@@ -0,0 +1,100 @@
+package ast
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/abusizhishen/zlang/token"
+)
+
+// Fprint writes the tree rooted at node to w as an indented S-expression,
+// one node per line:
+//
+//	(LetStatement
+//	  Name: (Identifier "a")
+//	  Value: (InfixExpression "+"
+//	    Left: (IntegerLiteral 1)
+//	    Right: (IntegerLiteral 2)))
+//
+// A node lists its kind and values such as names, operators and literals,
+// then its children labeled with the field they are stored in. Missing
+// children are left out, as are tokens and positions. A nil node is
+// printed as nil.
+func Fprint(w io.Writer, node Node) error {
+	var buf bytes.Buffer
+	sexpr(&buf, reflect.ValueOf(node), 0)
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// sexpr writes the node or HashPair v, a pointer or struct, at depth.
+func sexpr(buf *bytes.Buffer, v reflect.Value, depth int) {
+	if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		buf.WriteString("nil")
+		return
+	}
+
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	buf.WriteString("(" + v.Type().Name())
+
+	type child struct {
+		label string
+		value reflect.Value
+	}
+
+	var children []child
+	for i := 0; i < v.NumField(); i++ {
+		f, name := v.Field(i), v.Type().Field(i).Name
+		switch f.Kind() {
+		case reflect.String:
+			buf.WriteString(" " + strconv.Quote(f.String()))
+		case reflect.Int64:
+			buf.WriteString(" " + strconv.FormatInt(f.Int(), 10))
+		case reflect.Float64:
+			buf.WriteString(" " + strconv.FormatFloat(f.Float(), 'g', -1, 64))
+		case reflect.Bool:
+			buf.WriteString(" " + strconv.FormatBool(f.Bool()))
+		case reflect.Interface, reflect.Ptr:
+			if !f.IsNil() {
+				children = append(children, child{name, f.Elem()})
+			}
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				if elem := f.Index(j); elem.Kind() == reflect.Struct || !elem.IsNil() {
+					children = append(children, child{name, elem})
+				}
+			}
+		}
+	}
+
+	// nodes that are just a token, such as break or a comment
+	if v.NumField() == 1 && v.Type().Field(0).Type == tokenType {
+		buf.WriteString(" " + strconv.Quote(v.Field(0).Interface().(token.Token).Literal))
+	}
+
+	for _, c := range children {
+		buf.WriteString("\n" + strings.Repeat("  ", depth+1) + c.label + ": ")
+		if c.value.Kind() == reflect.Interface {
+			c.value = c.value.Elem()
+		}
+
+		sexpr(buf, c.value, depth+1)
+	}
+
+	buf.WriteByte(')')
+}
+
+// Sprint returns the S-expression Fprint writes for node, without the final
+// newline.
+func Sprint(node Node) string {
+	var buf bytes.Buffer
+	sexpr(&buf, reflect.ValueOf(node), 0)
+	return buf.String()
+}
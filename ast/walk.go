@@ -0,0 +1,197 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, in source order, followed
+// by a call of w.Visit(nil).
+//
+// The comments of a Program are not part of the tree and are not visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Leaves
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Bool,
+		*BranchStatement, *Comment, *BadStatement, *BadExpression:
+		// nothing to do
+
+	// Expressions
+	case *PrefixExpression:
+		walkExpr(v, n.Right)
+
+	case *InfixExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Right)
+
+	case *GroupExpress:
+		walkExpr(v, n.Express)
+
+	case *IfExpress:
+		walkExpr(v, n.Condition)
+		walkBlock(v, n.TrueStatement)
+		if n.ElseStatement != nil {
+			Walk(v, n.ElseStatement)
+		}
+
+	case *ConcatExpression:
+		walkExprList(v, n.Parts)
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			walkIdent(v, param)
+		}
+
+		walkBlock(v, n.Body)
+
+	case *CallExpression:
+		walkExpr(v, n.Function)
+		walkExprList(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExprList(v, n.Elements)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkExpr(v, pair.Key)
+			walkExpr(v, pair.Value)
+		}
+
+	case *IndexExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Index)
+
+	case *SliceExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Low)
+		walkExpr(v, n.High)
+
+	case *AssignExpression:
+		walkExpr(v, n.Target)
+		walkExpr(v, n.Value)
+
+	case *SwitchExpression:
+		walkExpr(v, n.Value)
+		for _, c := range n.Cases {
+			if c != nil {
+				Walk(v, c)
+			}
+		}
+
+		walkBlock(v, n.Default)
+
+	case *SwitchCase:
+		walkExprList(v, n.Values)
+		walkBlock(v, n.Body)
+
+	// Statements
+	case *ExpressionStatement:
+		walkExpr(v, n.Expression)
+
+	case *LetStatement:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+
+	case *ConstStatement:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+
+	case *ReturnStatement:
+		walkExpr(v, n.ReturnValue)
+
+	case *BlockStatement:
+		walkStmtList(v, n.Statements)
+
+	case *WhileStatement:
+		walkExpr(v, n.Condition)
+		walkBlock(v, n.Body)
+
+	case *ForStatement:
+		walkStmt(v, n.Init)
+		walkExpr(v, n.Condition)
+		walkStmt(v, n.Post)
+		walkBlock(v, n.Body)
+
+	case *ForInStatement:
+		walkIdent(v, n.Variable)
+		walkExpr(v, n.Iterable)
+		walkBlock(v, n.Body)
+
+	case *Program:
+		walkStmtList(v, n.Statements)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// The helpers below skip empty fields, which the parser leaves behind for
+// optional parts such as a bare return and after syntax errors. Typed nil
+// pointers are checked separately as they are not nil once wrapped in Node.
+
+func walkExpr(v Visitor, x Expression) {
+	if x != nil {
+		Walk(v, x)
+	}
+}
+
+func walkStmt(v Visitor, s Statement) {
+	if s != nil {
+		Walk(v, s)
+	}
+}
+
+func walkIdent(v Visitor, id *Identifier) {
+	if id != nil {
+		Walk(v, id)
+	}
+}
+
+func walkBlock(v Visitor, b *BlockStatement) {
+	if b != nil {
+		Walk(v, b)
+	}
+}
+
+func walkExprList(v Visitor, list []Expression) {
+	for _, x := range list {
+		walkExpr(v, x)
+	}
+}
+
+func walkStmtList(v Visitor, list []Statement) {
+	for _, s := range list {
+		walkStmt(v, s)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,191 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+)
+
+// nodes holds a zero value of every node type. TestWalkCoversAllNodes fails
+// when a type implementing Node is missing here, so a new node type cannot
+// be added without teaching Walk about it.
+var nodes = []ast.Node{
+	&ast.Program{},
+	&ast.Comment{},
+	&ast.BadStatement{},
+	&ast.BadExpression{},
+	&ast.ExpressionStatement{},
+	&ast.LetStatement{},
+	&ast.ConstStatement{},
+	&ast.ReturnStatement{},
+	&ast.BlockStatement{},
+	&ast.WhileStatement{},
+	&ast.ForStatement{},
+	&ast.ForInStatement{},
+	&ast.BranchStatement{},
+	&ast.Identifier{},
+	&ast.IntegerLiteral{},
+	&ast.FloatLiteral{},
+	&ast.StringLiteral{},
+	&ast.Bool{},
+	&ast.PrefixExpression{},
+	&ast.InfixExpression{},
+	&ast.GroupExpress{},
+	&ast.IfExpress{},
+	&ast.ConcatExpression{},
+	&ast.FunctionLiteral{},
+	&ast.CallExpression{},
+	&ast.ArrayLiteral{},
+	&ast.HashLiteral{},
+	&ast.IndexExpression{},
+	&ast.SliceExpression{},
+	&ast.AssignExpression{},
+	&ast.SwitchExpression{},
+	&ast.SwitchCase{},
+}
+
+// nodeTypes returns the names of the types of package ast that have a
+// TokenLiteral method, found from the source so nothing is left out.
+func nodeTypes(t *testing.T) []string {
+	fset := gotoken.NewFileSet()
+	pkgs, err := goparser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("cannot parse package ast: %v", err)
+	}
+
+	var names []string
+	for _, file := range pkgs["ast"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*goast.StarExpr); ok {
+				recv = star.X
+			}
+
+			names = append(names, recv.(*goast.Ident).Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestWalkCoversAllNodes(t *testing.T) {
+	known := make(map[string]ast.Node)
+	for _, n := range nodes {
+		known[reflect.TypeOf(n).Elem().Name()] = n
+	}
+
+	for _, name := range nodeTypes(t) {
+		n, ok := known[name]
+		if !ok {
+			t.Errorf("node type %s is missing from the walker tests", name)
+			continue
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Walk does not support %s: %v", name, r)
+				}
+			}()
+
+			ast.Inspect(n, func(ast.Node) bool { return true })
+		}()
+	}
+}
+
+// collector records the visited nodes, with ")" for every Visit(nil).
+type collector []string
+
+func (c *collector) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*c = append(*c, ")")
+	} else {
+		*c = append(*c, fmt.Sprintf("%T", node)[len("*ast."):])
+	}
+
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = -1", "Program LetStatement Identifier ) PrefixExpression IntegerLiteral ) ) ) )"},
+		{"a = b[1:]", "Program ExpressionStatement AssignExpression Identifier ) SliceExpression Identifier ) IntegerLiteral ) ) ) ) )"},
+		{"if (x) { 1 } else { 2.5 }", "Program ExpressionStatement IfExpress GroupExpress Identifier ) ) BlockStatement ExpressionStatement IntegerLiteral ) ) ) BlockStatement ExpressionStatement FloatLiteral ) ) ) ) ) )"},
+		{"fun(x) { return }", "Program ExpressionStatement FunctionLiteral Identifier ) BlockStatement ReturnStatement ) ) ) ) )"},
+		{"f({1: \"a${b}\"}, [true])", "Program ExpressionStatement CallExpression Identifier ) HashLiteral IntegerLiteral ) ConcatExpression StringLiteral ) Identifier ) StringLiteral ) ) ) ArrayLiteral Bool ) ) ) ) )"},
+		{"for let i = 0; i < 1; i += 1 { break }", "Program ForStatement LetStatement Identifier ) IntegerLiteral ) ) InfixExpression Identifier ) IntegerLiteral ) ) ExpressionStatement AssignExpression Identifier ) IntegerLiteral ) ) ) BlockStatement BranchStatement ) ) ) )"},
+		{"for x in xs { continue }", "Program ForInStatement Identifier ) Identifier ) BlockStatement BranchStatement ) ) ) )"},
+		{"switch x { case 1 { a } default { b } }", "Program ExpressionStatement SwitchExpression Identifier ) SwitchCase IntegerLiteral ) BlockStatement ExpressionStatement Identifier ) ) ) ) BlockStatement ExpressionStatement Identifier ) ) ) ) ) )"},
+		{"while (true) { x[0] }", "Program WhileStatement GroupExpress Bool ) ) BlockStatement ExpressionStatement IndexExpression Identifier ) IntegerLiteral ) ) ) ) ) )"},
+		{"let = 1", "Program BadStatement ) )"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		var c collector
+		ast.Walk(&c, program)
+
+		got := strings.Join(c, " ")
+		if got != tt.expected {
+			t.Errorf("walk wrong for %q.\nexpected=%s\ngot=     %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	l := lexer.New("let f = fun(a, b) { a + b }; f(1, 2)")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, id.Value)
+		}
+
+		return true
+	})
+
+	if got := strings.Join(idents, " "); got != "f a b a b f" {
+		t.Errorf("identifiers wrong. got=%q", got)
+	}
+
+	// returning false prunes the function body
+	idents = idents[:0]
+	ast.Inspect(program, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, id.Value)
+		}
+
+		_, fn := n.(*ast.FunctionLiteral)
+		return !fn
+	})
+
+	if got := strings.Join(idents, " "); got != "f f" {
+		t.Errorf("identifiers wrong after pruning. got=%q", got)
+	}
+}
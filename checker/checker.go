@@ -0,0 +1,223 @@
+// Package checker performs static checks on a parsed program that need to
+// know which declaration a name refers to.
+package checker
+
+import (
+	"fmt"
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/diagnostic"
+)
+
+// scope mirrors an object.Environment: the program, every function, every
+// for loop and every block get one.
+type scope struct {
+	decls map[string]*decl
+	outer *scope
+}
+
+type decl struct {
+	name     *ast.Identifier
+	constant bool
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{decls: make(map[string]*decl), outer: outer}
+}
+
+func (s *scope) lookup(name string) *decl {
+	for sc := s; sc != nil; sc = sc.outer {
+		if d, ok := sc.decls[name]; ok {
+			return d
+		}
+	}
+
+	return nil
+}
+
+type checker struct {
+	scope  *scope
+	errors diagnostic.ErrorList
+}
+
+// Check reports assignments to const bindings and declarations that shadow
+// a const binding of the same scope. Names are resolved in source order, so
+// a write inside a function to a constant declared after the function is
+// left to the evaluator.
+func Check(program *ast.Program) diagnostic.ErrorList {
+	c := &checker{scope: newScope(nil)}
+	for _, stmt := range program.Statements {
+		c.node(stmt)
+	}
+
+	return c.errors
+}
+
+func (c *checker) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		c.expr(node.Expression)
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+
+		c.open()
+		for _, stmt := range node.Statements {
+			c.node(stmt)
+		}
+
+		c.close()
+	case *ast.LetStatement:
+		c.expr(node.Value)
+		c.declare(node.Name, false)
+	case *ast.ConstStatement:
+		c.expr(node.Value)
+		c.declare(node.Name, true)
+	case *ast.ReturnStatement:
+		c.expr(node.ReturnValue)
+	case *ast.WhileStatement:
+		c.expr(node.Condition)
+		c.node(node.Body)
+	case *ast.ForStatement:
+		c.open()
+		if node.Init != nil {
+			c.node(node.Init)
+		}
+
+		c.expr(node.Condition)
+		if node.Post != nil {
+			c.node(node.Post)
+		}
+
+		c.node(node.Body)
+		c.close()
+	case *ast.ForInStatement:
+		c.expr(node.Iterable)
+		c.open()
+		c.declare(node.Variable, false)
+		c.node(node.Body)
+		c.close()
+	case ast.Expression:
+		c.expr(node)
+	}
+}
+
+func (c *checker) expr(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.AssignExpression:
+		if id, ok := exp.Target.(*ast.Identifier); ok {
+			c.assign(id)
+		} else {
+			c.expr(exp.Target)
+		}
+
+		c.expr(exp.Value)
+	case *ast.PrefixExpression:
+		c.expr(exp.Right)
+	case *ast.InfixExpression:
+		c.expr(exp.Left)
+		c.expr(exp.Right)
+	case *ast.GroupExpress:
+		c.expr(exp.Express)
+	case *ast.IfExpress:
+		c.expr(exp.Condition)
+		c.node(exp.TrueStatement)
+		if exp.ElseStatement != nil {
+			c.node(exp.ElseStatement)
+		}
+	case *ast.SwitchExpression:
+		c.expr(exp.Value)
+		for _, sc := range exp.Cases {
+			for _, v := range sc.Values {
+				c.expr(v)
+			}
+
+			c.node(sc.Body)
+		}
+
+		c.node(exp.Default)
+	case *ast.FunctionLiteral:
+		c.open()
+		for _, param := range exp.Parameters {
+			c.declare(param, false)
+		}
+
+		c.node(exp.Body)
+		c.close()
+	case *ast.CallExpression:
+		c.expr(exp.Function)
+		for _, arg := range exp.Arguments {
+			c.expr(arg)
+		}
+	case *ast.ConcatExpression:
+		for _, part := range exp.Parts {
+			c.expr(part)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.expr(el)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			c.expr(pair.Key)
+			c.expr(pair.Value)
+		}
+	case *ast.IndexExpression:
+		c.expr(exp.Left)
+		c.expr(exp.Index)
+	case *ast.SliceExpression:
+		c.expr(exp.Left)
+		c.expr(exp.Low)
+		c.expr(exp.High)
+	}
+}
+
+func (c *checker) open() {
+	c.scope = newScope(c.scope)
+}
+
+func (c *checker) close() {
+	c.scope = c.scope.outer
+}
+
+func (c *checker) declare(name *ast.Identifier, constant bool) {
+	if name == nil {
+		return
+	}
+
+	if d, ok := c.scope.decls[name.Value]; ok && d.constant {
+		c.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.ConstRedeclared,
+			Message:  fmt.Sprintf("cannot redeclare constant %s in the same scope", name.Value),
+			Pos:      name.Pos(),
+			End:      name.End(),
+			Related:  []diagnostic.Related{declaredHere(d)},
+		})
+		return
+	}
+
+	c.scope.decls[name.Value] = &decl{name: name, constant: constant}
+}
+
+func (c *checker) assign(name *ast.Identifier) {
+	if d := c.scope.lookup(name.Value); d != nil && d.constant {
+		c.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.ConstAssignment,
+			Message:  fmt.Sprintf("cannot assign to constant %s", name.Value),
+			Pos:      name.Pos(),
+			End:      name.End(),
+			Hint:     "declare it with let to allow assignments",
+			Related:  []diagnostic.Related{declaredHere(d)},
+		})
+	}
+}
+
+func declaredHere(d *decl) diagnostic.Related {
+	return diagnostic.Related{
+		Message: fmt.Sprintf("%s declared as constant here", d.name.Value),
+		Pos:     d.name.Pos(),
+		End:     d.name.End(),
+	}
+}
@@ -0,0 +1,77 @@
+package checker_test
+
+import (
+	"github.com/abusizhishen/zlang/checker"
+	"github.com/abusizhishen/zlang/diagnostic"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    diagnostic.Code
+		pos     string
+		related string
+	}{
+		{"const a = 1\na = 2", diagnostic.ConstAssignment, "2:1", "1:7"},
+		{"const a = 1; a += 2", diagnostic.ConstAssignment, "1:14", "1:7"},
+		{"const a = 1; let f = fun() { a = 2 }", diagnostic.ConstAssignment, "1:30", "1:7"},
+		{"const a = 1; if true { a = 2 }", diagnostic.ConstAssignment, "1:24", "1:7"},
+		{"const a = 1; for i in 3 { a = i }", diagnostic.ConstAssignment, "1:27", "1:7"},
+		{"const a = 1; let b = [a = 2]", diagnostic.ConstAssignment, "1:23", "1:7"},
+		{"const a = 1; let a = 2", diagnostic.ConstRedeclared, "1:18", "1:7"},
+		{"const a = 1\nconst a = 2", diagnostic.ConstRedeclared, "2:7", "1:7"},
+		{"let f = fun() { while true { const a = 1; let a = 2 } }", diagnostic.ConstRedeclared, "1:47", "1:36"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := checker.Check(program)
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error, got %d: %v input:%q", len(errors), errors, tt.input)
+			continue
+		}
+
+		d := errors[0]
+		if d.Code != tt.code || d.Pos.String() != tt.pos {
+			t.Errorf("error wrong. expected=%s at %s, got=%s at %s input:%q", tt.code, tt.pos, d.Code, d.Pos, tt.input)
+		}
+
+		if len(d.Related) != 1 || d.Related[0].Pos.String() != tt.related {
+			t.Errorf("related wrong. expected declaration at %s, got=%+v input:%q", tt.related, d.Related, tt.input)
+		}
+	}
+}
+
+func TestCheckAllowed(t *testing.T) {
+	tests := []string{
+		"const a = 1; a + 1",
+		"const a = 1; let f = fun(a) { a = 2 }",
+		"const a = 1; let f = fun() { let a = 2; a = 3 }",
+		"const a = 1; for let a = 0; a < 3; a += 1 { }",
+		"const a = 1; for a in 3 { a = 0 }",
+		"const a = [1]; a[0] = 2",
+		"let a = 1; a = 2; const b = a",
+		"let a = 1; const a = 2",
+		"let f = fun() { b = 1 }; const b = 0",
+		"const a = 1; while true { let a = 2 }",
+		"let i = 0; while i < 3 { const c = i; i += 1 }",
+		"for let j = 0; j < 3; j += 1 { const c = j }",
+		"for x in 3 { const c = x }",
+		"if x == 1 { const y = 2 } else { const y = 3 }",
+		"switch x { case 1 { const y = 2 } default { const y = 3 } }",
+	}
+
+	for _, input := range tests {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if errors := checker.Check(program); len(errors) != 0 {
+			t.Errorf("expected no errors, got %v input:%q", errors, input)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/abusizhishen/zlang/token"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "error":
+		*s = Error
+	case "warning":
+		*s = Warning
+	default:
+		return fmt.Errorf("unknown severity %q", text)
+	}
+
+	return nil
+}
+
+// Code identifies the kind of a diagnostic so tools can match on it
+// without parsing the message.
+type Code string
+
+const (
+	UnexpectedToken   Code = "unexpected-token"
+	NoPrefixParseFn   Code = "no-prefix-parse-fn"
+	InvalidInteger    Code = "invalid-integer"
+	InvalidFloat      Code = "invalid-float"
+	IntegerOverflow   Code = "integer-overflow"
+	MissingExpression Code = "missing-expression"
+	DuplicateDefault  Code = "duplicate-default"
+	BranchOutsideLoop Code = "branch-outside-loop"
+	InvalidAssignment Code = "invalid-assignment"
+	ConstAssignment   Code = "const-assignment"
+	ConstRedeclared   Code = "const-redeclared"
+	TooManyErrors     Code = "too-many-errors"
+
+	InvalidEscape       Code = "invalid-escape"
+	UnterminatedString  Code = "unterminated-string"
+	UnterminatedComment Code = "unterminated-comment"
+	InvalidUTF8         Code = "invalid-utf8"
+	IllegalCharacter    Code = "illegal-character"
+	InvalidNumber       Code = "invalid-number"
+	ReadError           Code = "read-error"
+)
+
+type Diagnostic struct {
+	Severity Severity          `json:"severity"`
+	Code     Code              `json:"code"`
+	Message  string            `json:"message"`
+	Pos      token.Position    `json:"pos"`
+	End      token.Position    `json:"end"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Found    token.TokenType   `json:"found,omitempty"`
+	Hint     string            `json:"hint,omitempty"`
+	Related  []Related         `json:"related,omitempty"`
+}
+
+// Related is a secondary location that explains a diagnostic, such as the
+// declaration of a constant that is assigned to.
+type Related struct {
+	Message string         `json:"message"`
+	Pos     token.Position `json:"pos"`
+	End     token.Position `json:"end"`
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Pos.IsValid() || d.Pos.Filename != "" {
+		return d.Pos.String() + ": " + d.Message
+	}
+
+	return d.Message
+}
+
+// ErrorList is a list of diagnostics. The zero value is an empty list ready
+// to use.
+type ErrorList []*Diagnostic
+
+func (l *ErrorList) Add(d *Diagnostic) {
+	*l = append(*l, d)
+}
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ErrorList) Less(i, j int) bool {
+	a, b := l[i].Pos, l[j].Pos
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+
+	if a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+
+	return l[i].Message < l[j].Message
+}
+
+// Sort sorts the list by filename, position and message. The sort is stable
+// so diagnostics reported at the same place keep their order.
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+// RemoveMultiples sorts the list and drops every diagnostic that repeats the
+// position, code and message of the one before it.
+func (l *ErrorList) RemoveMultiples() {
+	l.Sort()
+	var last *Diagnostic
+	i := 0
+	for _, d := range *l {
+		if last == nil || d.Pos != last.Pos || d.Code != last.Code || d.Message != last.Message {
+			last = d
+			(*l)[i] = d
+			i++
+		}
+	}
+
+	*l = (*l)[:i]
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns an error equivalent to this list, or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// WriteText prints every diagnostic followed by the source line it points
+// at with a caret under the reported range. src is the text that was parsed;
+// when it is empty only the messages are printed.
+func (l ErrorList) WriteText(w io.Writer, src string) error {
+	var out bytes.Buffer
+	for _, d := range l {
+		if d.Pos.IsValid() || d.Pos.Filename != "" {
+			out.WriteString(d.Pos.String() + ": ")
+		}
+
+		fmt.Fprintf(&out, "%s", d.Severity)
+		if d.Code != "" {
+			fmt.Fprintf(&out, "[%s]", d.Code)
+		}
+
+		out.WriteString(": " + d.Message + "\n")
+		if line, ok := sourceLine(src, d.Pos); ok {
+			out.WriteString("\t" + line + "\n")
+			out.WriteString("\t" + caret(line, d.Pos, d.End) + "\n")
+		}
+
+		for _, r := range d.Related {
+			out.WriteString("\t" + r.Pos.String() + ": note: " + r.Message + "\n")
+			if line, ok := sourceLine(src, r.Pos); ok {
+				out.WriteString("\t\t" + line + "\n")
+				out.WriteString("\t\t" + caret(line, r.Pos, r.End) + "\n")
+			}
+		}
+
+		if d.Hint != "" {
+			out.WriteString("\thint: " + d.Hint + "\n")
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// WriteJSON prints the list as a JSON array.
+func (l ErrorList) WriteJSON(w io.Writer) error {
+	if l == nil {
+		l = ErrorList{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// sourceLine returns the line of src that contains pos, without its line
+// terminator.
+func sourceLine(src string, pos token.Position) (string, bool) {
+	if src == "" || !pos.IsValid() || pos.Offset > len(src) {
+		return "", false
+	}
+
+	start := strings.LastIndexByte(src[:pos.Offset], '\n') + 1
+	end := strings.IndexByte(src[pos.Offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += pos.Offset
+	}
+
+	return strings.TrimRight(src[start:end], "\r"), true
+}
+
+// caret builds the marker line for [pos, end) on line. Columns count runes.
+// Tabs are kept and wide characters are padded with an ideographic space so
+// the marker lines up with the source no matter the tab width.
+func caret(line string, pos, end token.Position) string {
+	var out strings.Builder
+	col := pos.Column - 1
+	for i, r := range []rune(line) {
+		if i >= col {
+			break
+		}
+
+		switch {
+		case r == '\t':
+			out.WriteByte('\t')
+		case unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana):
+			out.WriteRune('\u3000')
+		default:
+			out.WriteByte(' ')
+		}
+	}
+
+	width := 1
+	if end.Line == pos.Line && end.Column > pos.Column {
+		width = end.Column - pos.Column
+	}
+
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
@@ -0,0 +1,140 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/abusizhishen/zlang/token"
+	"testing"
+)
+
+func pos(offset, line, column int) token.Position {
+	return token.Position{Offset: offset, Line: line, Column: column}
+}
+
+func TestErrorList_RemoveMultiples(t *testing.T) {
+	var list ErrorList
+	list.Add(&Diagnostic{Message: "b", Pos: pos(8, 2, 3)})
+	list.Add(&Diagnostic{Message: "a", Pos: pos(1, 1, 2)})
+	list.Add(&Diagnostic{Message: "b", Pos: pos(8, 2, 3)})
+	list.Add(&Diagnostic{Message: "c", Pos: pos(1, 1, 2)})
+
+	list.RemoveMultiples()
+	if len(list) != 3 {
+		t.Fatalf("list does not contain 3 diagnostics, got:%d", len(list))
+	}
+
+	expected := []string{"1:2: a", "1:2: c", "2:3: b"}
+	for i, msg := range expected {
+		if list[i].Error() != msg {
+			t.Errorf("list[%d] wrong. expected=%q, got=%q", i, msg, list[i].Error())
+		}
+	}
+
+	if list.Error() != "1:2: a (and 2 more errors)" {
+		t.Errorf("list.Error() wrong. got=%q", list.Error())
+	}
+}
+
+func TestErrorList_WriteText(t *testing.T) {
+	src := "let a = 1;\n\tlet = 2;"
+	list := ErrorList{{
+		Severity: Error,
+		Code:     UnexpectedToken,
+		Message:  "expected next token type to be IDENTIFIER, got: =",
+		Pos:      pos(16, 2, 6),
+		End:      pos(17, 2, 7),
+		Hint:     "name the binding",
+	}}
+
+	var out bytes.Buffer
+	if err := list.WriteText(&out, src); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2:6: error[unexpected-token]: expected next token type to be IDENTIFIER, got: =\n" +
+		"\t\tlet = 2;\n" +
+		"\t\t    ^\n" +
+		"\thint: name the binding\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestErrorList_WriteJSON(t *testing.T) {
+	list := ErrorList{{
+		Severity: Error,
+		Code:     UnexpectedToken,
+		Message:  "boom",
+		Pos:      pos(0, 1, 1),
+		End:      pos(3, 1, 4),
+		Expected: []token.TokenType{token.ASSIGN},
+		Found:    token.Integer,
+	}}
+
+	var out bytes.Buffer
+	if err := list.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ErrorList
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("could not decode %s: %v", out.String(), err)
+	}
+
+	if len(decoded) != 1 {
+		t.Fatalf("decoded does not contain 1 diagnostic, got:%d", len(decoded))
+	}
+
+	d := decoded[0]
+	if d.Severity != Error || d.Code != UnexpectedToken || d.Pos != list[0].Pos || d.End != list[0].End ||
+		len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN || d.Found != token.Integer {
+		t.Errorf("decoded diagnostic wrong. got=%+v", d)
+	}
+
+	if !bytes.Contains(out.Bytes(), []byte(`"severity": "error"`)) {
+		t.Errorf("severity not rendered as text: %s", out.String())
+	}
+}
+
+func TestErrorList_WriteTextWide(t *testing.T) {
+	src := `let 名字 = @`
+	list := ErrorList{{Message: "illegal character", Pos: pos(13, 1, 10), End: pos(14, 1, 11)}}
+
+	var out bytes.Buffer
+	if err := list.WriteText(&out, src); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "1:10: error: illegal character\n" +
+		"\tlet 名字 = @\n" +
+		"\t    　　   ^\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestErrorList_WriteTextRelated(t *testing.T) {
+	src := "const a = 1\na = 2"
+	list := ErrorList{{
+		Code:    ConstAssignment,
+		Message: "cannot assign to constant a",
+		Pos:     pos(12, 2, 1),
+		End:     pos(13, 2, 2),
+		Related: []Related{{Message: "a declared as constant here", Pos: pos(6, 1, 7), End: pos(7, 1, 8)}},
+	}}
+
+	var out bytes.Buffer
+	if err := list.WriteText(&out, src); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2:1: error[const-assignment]: cannot assign to constant a\n" +
+		"\ta = 2\n" +
+		"\t^\n" +
+		"\t1:7: note: a declared as constant here\n" +
+		"\t\tconst a = 1\n" +
+		"\t\t      ^\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,933 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/object"
+	"github.com/abusizhishen/zlang/token"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.LetStatement:
+		if env.IsLocalConst(node.Name.Value) {
+			return errorAt(node.Name, newError("cannot redeclare constant %s", node.Name.Value))
+		}
+
+		val := evalOptional(node.Value, env)
+		if isError(val) || isSignal(val) {
+			return val
+		}
+
+		env.Set(node.Name.Value, val)
+		return NULL
+	case *ast.ConstStatement:
+		if env.IsLocalConst(node.Name.Value) {
+			return errorAt(node.Name, newError("cannot redeclare constant %s", node.Name.Value))
+		}
+
+		val := evalOptional(node.Value, env)
+		if isError(val) || isSignal(val) {
+			return val
+		}
+
+		env.SetConst(node.Name.Value, val)
+		return NULL
+	case *ast.ReturnStatement:
+		val := evalOptional(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+
+		return &object.ReturnValue{Value: val}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.BranchStatement:
+		if node.Token.Type == token.Break {
+			return BREAK
+		}
+
+		return CONTINUE
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.ConcatExpression:
+		return evalConcatExpression(node, env)
+	case *ast.Bool:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Identifier:
+		return errorAt(node, evalIdentifier(node, env))
+	case *ast.GroupExpress:
+		return Eval(node.Express, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		return errorAt(node, evalPrefixExpression(node.Operator, right))
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
+
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		return errorAt(node, evalInfixExpression(node.Operator, left, right))
+	case *ast.IfExpress:
+		return evalIfExpress(node, env)
+	case *ast.SwitchExpression:
+		return evalSwitchExpression(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		return errorAt(node, applyFunction(function, args))
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		return errorAt(node.Index, evalIndexExpression(left, index))
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.BadStatement, *ast.BadExpression:
+		return errorAt(node, newError("cannot evaluate invalid code"))
+	}
+
+	return newError("unknown node: %T", node)
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs a for loop. Init, condition, post and body share a
+// scope of their own, so the loop variables are gone after the loop.
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	env = object.NewEnclosedEnvironment(env)
+	if fs.Init != nil {
+		if init := Eval(fs.Init, env); isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := evalLoopBody(fs.Body, env); done {
+			return result
+		}
+
+		if fs.Post != nil {
+			if post := Eval(fs.Post, env); isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+// evalForInStatement binds the variable in a new scope for every element, so
+// closures created in the body keep the element of their own iteration.
+func evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var elements []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements = append(elements, iterable.Elements...)
+	case *object.Hash:
+		for _, pair := range iterable.Pairs {
+			elements = append(elements, pair.Key)
+		}
+	case *object.String:
+		for _, r := range iterable.Value {
+			elements = append(elements, &object.String{Value: string(r)})
+		}
+	case *object.Integer:
+		for i := int64(0); i < iterable.Value; i++ {
+			loopEnv := object.NewEnclosedEnvironment(env)
+			loopEnv.Set(fs.Variable.Value, &object.Integer{Value: i})
+			if result, done := evalLoopBody(fs.Body, loopEnv); done {
+				return result
+			}
+		}
+
+		return NULL
+	default:
+		return errorAt(fs.Iterable, newError("cannot iterate over %s", iterable.Type()))
+	}
+
+	for _, element := range elements {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, element)
+		if result, done := evalLoopBody(fs.Body, loopEnv); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// evalLoopBody runs one iteration. done reports whether the loop stops, with
+// result being what the loop statement evaluates to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, done bool) {
+	switch result := evalBlockStatement(body, env); result.(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// evalOptional evaluates an expression that the parser may have left empty,
+// treating a missing value as null.
+func evalOptional(exp ast.Expression, env *object.Environment) object.Object {
+	if exp == nil {
+		return NULL
+	}
+
+	return Eval(exp, env)
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object = NULL
+	for _, stmt := range program.Statements {
+		result = Eval(stmt, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement runs block in a scope of its own, so names declared in
+// it, such as the constants of a loop body, are gone after every run.
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
+	if block == nil {
+		return result
+	}
+
+	env = object.NewEnclosedEnvironment(env)
+	for _, stmt := range block.Statements {
+		result = Eval(stmt, env)
+
+		// keep the ReturnValue wrapped so enclosing blocks stop as well
+		if isError(result) || isSignal(result) {
+			return result
+		}
+	}
+
+	return result
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	val, ok := env.Get(node.Value)
+	if !ok {
+		return newError("identifier not found: %s", node.Value)
+	}
+
+	return val
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		switch right := right.(type) {
+		case *object.Integer:
+			if right.Value == math.MinInt64 {
+				return newError("integer overflow: -(%d)", right.Value)
+			}
+
+			return &object.Integer{Value: -right.Value}
+		case *object.Float:
+			return &object.Float{Value: -right.Value}
+		default:
+			return newError("unknown operator: -%s", right.Type())
+		}
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, toFloat(left), toFloat(right))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression evaluates && and ||. The right operand is only
+// evaluated when left does not decide the result already.
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.Integer).Value
+	r := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		sum := l + r
+		if (sum > l) != (r > 0) {
+			return newError("integer overflow: %d + %d", l, r)
+		}
+
+		return &object.Integer{Value: sum}
+	case "-":
+		diff := l - r
+		if (diff < l) != (r > 0) {
+			return newError("integer overflow: %d - %d", l, r)
+		}
+
+		return &object.Integer{Value: diff}
+	case "*":
+		product := l * r
+		if l != 0 && (product/l != r || (l == -1 && r == math.MinInt64)) {
+			return newError("integer overflow: %d * %d", l, r)
+		}
+
+		return &object.Integer{Value: product}
+	case "/":
+		if r == 0 {
+			return newError("division by zero: %d / %d", l, r)
+		}
+
+		if l == math.MinInt64 && r == -1 {
+			return newError("integer overflow: %d / %d", l, r)
+		}
+
+		return &object.Integer{Value: l / r}
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression evaluates arithmetic and comparisons on floats.
+// Integer operands mixed with floats have already been promoted.
+func evalFloatInfixExpression(operator string, l, r float64) object.Object {
+	switch operator {
+	case "+":
+		return &object.Float{Value: l + r}
+	case "-":
+		return &object.Float{Value: l - r}
+	case "*":
+		return &object.Float{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("division by zero: %s / %s", (&object.Float{Value: l}).Inspect(), (&object.Float{Value: r}).Inspect())
+		}
+
+		return &object.Float{Value: l / r}
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", object.FLOAT_OBJ, operator, object.FLOAT_OBJ)
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts a number object to float64, promoting integers.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.String).Value
+	r := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: l + r}
+	case "<":
+		return nativeBoolToBooleanObject(l < r)
+	case ">":
+		return nativeBoolToBooleanObject(l > r)
+	case "<=":
+		return nativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return nativeBoolToBooleanObject(l >= r)
+	case "==":
+		return nativeBoolToBooleanObject(l == r)
+	case "!=":
+		return nativeBoolToBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalConcatExpression joins the parts of an interpolated string, using the
+// Inspect form of values that are not strings.
+func evalConcatExpression(ce *ast.ConcatExpression, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range ce.Parts {
+		evaluated := Eval(part, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+
+		out.WriteString(evaluated.Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+func evalIfExpress(ie *ast.IfExpress, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.TrueStatement, env)
+	}
+
+	if ie.ElseStatement == nil {
+		return NULL
+	}
+
+	return Eval(ie.ElseStatement, env)
+}
+
+func evalSwitchExpression(se *ast.SwitchExpression, env *object.Environment) object.Object {
+	var value object.Object
+	if se.Value != nil {
+		value = Eval(se.Value, env)
+		if isError(value) {
+			return value
+		}
+	}
+
+	for _, c := range se.Cases {
+		for _, exp := range c.Values {
+			candidate := Eval(exp, env)
+			if isError(candidate) {
+				return candidate
+			}
+
+			matched := isTruthy(candidate)
+			if value != nil {
+				matched = isEqual(value, candidate)
+			}
+
+			if matched {
+				return Eval(c.Body, env)
+			}
+		}
+	}
+
+	if se.Default == nil {
+		return NULL
+	}
+
+	return Eval(se.Default, env)
+}
+
+// evalIndexExpression returns left[index] for hashes, arrays and strings,
+// where strings are indexed by rune. Negative indices count from the end.
+func evalIndexExpression(left, index object.Object) object.Object {
+	var length int
+	switch left := left.(type) {
+	case *object.Hash:
+		return evalHashIndexExpression(left, index)
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return newError("index must be INTEGER, got %s", index.Type())
+	}
+
+	idx := i.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+
+	if idx < 0 || idx >= int64(length) {
+		return newError("index out of range: %d with length %d", i.Value, length)
+	}
+
+	if array, ok := left.(*object.Array); ok {
+		return array.Elements[idx]
+	}
+
+	return &object.String{Value: string([]rune(left.(*object.String).Value)[idx])}
+}
+
+// evalAssignExpression assigns to an existing name or to an element of an
+// array or a hash and returns the assigned value. For compound assignments
+// the target is evaluated only once.
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if ae.Operator != "=" {
+			if current = Eval(target, env); isError(current) {
+				return current
+			}
+		}
+
+		if env.IsConst(target.Value) {
+			return errorAt(target, newError("cannot assign to constant %s", target.Value))
+		}
+
+		value := evalAssignedValue(ae, current, env)
+		if isError(value) {
+			return value
+		}
+
+		if !env.Assign(target.Value, value) {
+			return errorAt(target, newError("assignment to undeclared variable: %s", target.Value))
+		}
+
+		return value
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if ae.Operator != "=" {
+			if current = errorAt(target.Index, evalIndexExpression(left, index)); isError(current) {
+				return current
+			}
+		}
+
+		value := evalAssignedValue(ae, current, env)
+		if isError(value) {
+			return value
+		}
+
+		if err := evalIndexAssignment(left, index, value); err != nil {
+			return errorAt(target.Index, err)
+		}
+
+		return value
+	default:
+		return errorAt(ae.Target, newError("cannot assign to %s", ae.Target))
+	}
+}
+
+// evalAssignedValue evaluates the right side of an assignment and, for a
+// compound assignment, combines it with the current value of the target.
+func evalAssignedValue(ae *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	value := Eval(ae.Value, env)
+	if isError(value) || current == nil {
+		return value
+	}
+
+	operator := strings.TrimSuffix(ae.Operator, "=")
+	return errorAt(ae, evalInfixExpression(operator, current, value))
+}
+
+// evalIndexAssignment stores value at left[index]. It returns an error
+// object when left cannot be assigned to at index.
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("index must be INTEGER, got %s", index.Type())
+		}
+
+		idx, length := i.Value, int64(len(left.Elements))
+		if idx < 0 {
+			idx += length
+		}
+
+		if idx < 0 || idx >= length {
+			return newError("index out of range: %d with length %d", i.Value, length)
+		}
+
+		left.Elements[idx] = value
+		return nil
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.Set(key, value)
+		return nil
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// evalHashIndexExpression returns hash[key], or null when key is missing.
+func evalHashIndexExpression(hash *object.Hash, key object.Object) object.Object {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", key.Type())
+	}
+
+	if value, ok := hash.Get(hashable); ok {
+		return value
+	}
+
+	return NULL
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return errorAt(pair.Key, newError("unusable as hash key: %s", key.Type()))
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashable, value)
+	}
+
+	return hash
+}
+
+// evalSliceExpression returns left[low:high] as a new array or string.
+// Missing bounds default to the start and the end, negative ones count from
+// the end.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	default:
+		return errorAt(node, newError("slice operator not supported: %s", left.Type()))
+	}
+
+	low, err := evalSliceBound(node.Low, 0, length, env)
+	if err != nil {
+		return err
+	}
+
+	high, err := evalSliceBound(node.High, length, length, env)
+	if err != nil {
+		return err
+	}
+
+	if low < 0 || high > int64(length) || low > high {
+		return errorAt(node, newError("slice bounds out of range: [%d:%d] with length %d", low, high, length))
+	}
+
+	if array, ok := left.(*object.Array); ok {
+		elements := make([]object.Object, high-low)
+		copy(elements, array.Elements[low:high])
+		return &object.Array{Elements: elements}
+	}
+
+	return &object.String{Value: string([]rune(left.(*object.String).Value)[low:high])}
+}
+
+// evalSliceBound evaluates an optional slice bound, returning def when it is
+// missing and resolving negative values against length.
+func evalSliceBound(bound ast.Expression, def, length int, env *object.Environment) (int64, object.Object) {
+	if bound == nil {
+		return int64(def), nil
+	}
+
+	value := Eval(bound, env)
+	if isError(value) {
+		return 0, value
+	}
+
+	i, ok := value.(*object.Integer)
+	if !ok {
+		return 0, errorAt(bound, newError("slice bound must be INTEGER, got %s", value.Type()))
+	}
+
+	if i.Value < 0 {
+		return i.Value + int64(length), nil
+	}
+
+	return i.Value, nil
+}
+
+// isEqual reports whether left == right would hold. Numbers compare by
+// value across integers and floats; other values of different types are
+// never equal.
+func isEqual(left, right object.Object) bool {
+	if isNumber(left) && isNumber(right) && left.Type() != right.Type() {
+		return toFloat(left) == toFloat(right)
+	}
+
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.Float:
+		return left.Value == right.(*object.Float).Value
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	default:
+		return left == right
+	}
+}
+
+// evalExpressions evaluates exps from left to right. On error it returns a
+// slice holding only that error.
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("not a function: %s", fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+	}
+
+	env := object.NewEnclosedEnvironment(function.Env)
+	for i, param := range function.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	evaluated := Eval(function.Body, env)
+	return unwrapReturnValue(evaluated)
+}
+
+// unwrapReturnValue stops a return from propagating past the function that
+// executed it.
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// errorAt records the position of node on obj if it is an error that does
+// not know where it was raised yet.
+func errorAt(node ast.Node, obj object.Object) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return obj
+}
+
+// isSignal reports whether obj is a return, break or continue that has to
+// travel up to the enclosing function or loop.
+func isSignal(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+
+	return false
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
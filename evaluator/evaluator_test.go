@@ -0,0 +1,920 @@
+package evaluator
+
+import (
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/object"
+	"github.com/abusizhishen/zlang/parser"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"-10", -10},
+		{"--5", 5},
+		{"-9223372036854775808", -9223372036854775808},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2", 16},
+		{"-50 + 100 + -50", 0},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"!true", false},
+		{"!!true", true},
+		{"!5", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 0", true},
+		{"let x = 5; 0 <= x && x < 10", true},
+		{"false && undefined", false},
+		{"true || undefined", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestIfExpress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1) { 10 } else { 20 }", 10},
+		{"if (false) { 10 }", nil},
+		{"let x = if true { 1; 2 } else { 3 }\n x", 2},
+		{"let x = if false { 1 }\n x", nil},
+		{"if 1 < 2 { if true { return 10 }\n 1 }\n 2", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5\nlet b = a\nlet c = a + b + 5\nc", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"let a = 1\nreturn a + 1\n9", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	if evaluated := testEval(t, "return; 9"); evaluated != NULL {
+		t.Errorf("bare return is not NULL. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false } else { 1 }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"1 / 0", "division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		t.Errorf("parse error: %q input:%q", err, input)
+	}
+
+	return Eval(program, object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestErrorPosition(t *testing.T) {
+	evaluated := testEval(t, "1;\n  -true")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Pos.String() != "2:3" {
+		t.Errorf("wrong error position. expected=2:3, got=%s", errObj.Pos)
+	}
+}
+
+func TestBadNodes(t *testing.T) {
+	for _, input := range []string{"let x = 1 +", "let = 1", "-"} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		evaluated := Eval(program, object.NewEnvironment())
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) input:%q", evaluated, evaluated, input)
+			continue
+		}
+
+		if errObj.Message != "cannot evaluate invalid code" {
+			t.Errorf("wrong error message. got=%q input:%q", errObj.Message, input)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	evaluated := testEval(t, "fun(x) { x + 2; };")
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 || fn.Parameters[0].String() != "x" {
+		t.Fatalf("function has wrong parameters. got=%v", fn.Parameters)
+	}
+
+	if fn.Body.Statements[0].String() != "(x + 2)" {
+		t.Fatalf("body is not %q. got=%q", "(x + 2)", fn.Body.Statements[0].String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fun(x) { x; }; identity(5);", 5},
+		{"let identity = fun(x) { return x; }; identity(5);", 5},
+		{"let double = fun(x) { x * 2; }; double(5);", 10},
+		{"let add = fun(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fun(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fun(x) { x; }(5)", 5},
+		{"let f = fun() { return 1; 2 }; f() + 10", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let newAdder = fun(x) {
+	fun(y) { x + y }
+}
+let addTwo = newAdder(2)
+addTwo(3)`, 5},
+		{`
+let add = fun(a, b) { a + b }
+let applyFunc = fun(a, b, func) { func(a, b) }
+applyFunc(2, 2, add)`, 4},
+		{`
+let x = 10
+let shadow = fun(x) { x * 2 }
+shadow(1) + x`, 12},
+		{`
+let fact = fun(n) {
+	let r = if (n < 2) { 1 } else { n * fact(n - 1) }
+	return r
+}
+fact(5)`, 120},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let f = fun(a, b) { a }; f(1)", "wrong number of arguments: want=2, got=1"},
+		{"let f = fun() { 1 }; f(1, 2)", "wrong number of arguments: want=0, got=2"},
+		{"let a = 1; a(1)", "not a function: INTEGER"},
+		{"let f = fun(a) { a }; f(b)", "identifier not found: b"},
+		{"let f = fun() { y }; let g = fun() { let y = 1; f() }; g()", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestIfStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if true { 10 }", 10},
+		{"if false { 10 }", nil},
+		{"if 1 > 2 { 10 } else { 20 }", 20},
+		{"let x = 2\nif x == 1 { 10 } else if x == 2 { 20 } else { 30 }", 20},
+		{"let x = 3\nif x == 1 { 10 } else if x == 2 { 20 } else { 30 }", 30},
+		{"let x = 3\nif x == 1 { 10 } else if x == 2 { 20 }", nil},
+		{"let f = fun(x) { if x > 0 { return 1 } else if x < 0 { return -1 }\n 0 }\nf(-5)", -1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestSwitchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"switch 2 { case 1 { 10 } case 2 { 20 } default { 30 } }", 20},
+		{"switch 5 { case 1 { 10 } case 2 { 20 } default { 30 } }", 30},
+		{"switch 5 { case 1 { 10 } }", nil},
+		{"switch 3 { case 1, 2 { 10 } case 3, 4 { 20 } }", 20},
+		{"switch 1 { case 1 { 10 } case 1 { 20 } }", 10},
+		{"switch true { case 1 { 10 } case true { 20 } }", 20},
+		{"let x = 7\nswitch { case x < 5 { 1 } case x < 10 { 2 } default { 3 } }", 2},
+		{"let v = switch 1 + 1 { default { 0 } case 2 { let a = 4; a * 2 } }\nv", 8},
+		{"let f = fun(x) { switch x { case 0 { return 100 } }\n x }\nf(0)", 100},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	input := `
+let hit = fun() { 1 / 0 }
+let a = false && hit()
+let b = true || hit()
+a || b`
+
+	testBooleanObject(t, testEval(t, input), true)
+
+	evaluated := testEval(t, "true && undefined")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "identifier not found: undefined" {
+		t.Errorf("right side was not evaluated. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello World!"`, "Hello World!"},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`"line\n\u{4e16}"`, "line\n世"},
+		{`let name = "zlang"; "hello ${name}!"`, "hello zlang!"},
+		{`let n = 3; "${n} * 2 = ${n * 2}"`, "3 * 2 = 6"},
+		{`"${true} ${if false { 1 }}"`, "true null"},
+		{`let greet = fun(who) { "hi ${who}" }; greet("bob")`, "hi bob"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+
+	boolTests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`"b" >= "a"`, true},
+		{`switch "x" { case "y" { false } case "x" { true } }`, true},
+	}
+
+	for _, tt := range boolTests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	evaluated := testEval(t, `"Hello" - "World"`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "unknown operator: STRING - STRING" {
+		t.Errorf("wrong error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	evaluated = testEval(t, `"a" + 1`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "type mismatch: STRING + INTEGER" {
+		t.Errorf("wrong error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	evaluated := testEval(t, "let 名字 = \"世界\"\nlet 问候 = fun(谁) { \"你好, ${谁}\" }\n问候(名字)")
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "你好, 世界" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999},
+	}
+
+	for _, tt := range floats {
+		evaluated := testEval(t, tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v) input:%q", evaluated, evaluated, tt.input)
+			continue
+		}
+
+		if result.Value != tt.expected {
+			t.Errorf("object has wrong value. got=%g, want=%g", result.Value, tt.expected)
+		}
+	}
+
+	integers := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x10 + 0b11 + 0o7", 26},
+		{"1_000 * 3", 3000},
+		{"7 / 2", 3},
+	}
+
+	for _, tt := range integers {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	bools := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2.5 >= 3", false},
+		{"0.1 + 0.2 != 0.3", true},
+		{"switch 2 { case 2.0 { true } default { false } }", true},
+	}
+
+	for _, tt := range bools {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	inspects := []struct {
+		input    string
+		expected string
+	}{
+		{"2.0", "2.0"},
+		{"1 + 0.5", "1.5"},
+		{"1e21", "1e+21"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+	}
+
+	for _, tt := range inspects {
+		if actual := testEval(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"0x7fffffffffffffff * 2", "integer overflow: 9223372036854775807 * 2"},
+		{"let min = -9223372036854775807 - 1; min / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"let min = -9223372036854775807 - 1; -min", "integer overflow: -(-9223372036854775808)"},
+		{"1.5 / 0", "division by zero: 1.5 / 0.0"},
+		{"1.0 / 0.0", "division by zero: 1.0 / 0.0"},
+		{"-9223372036854775808 - 1", "integer overflow: -9223372036854775808 - 1"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) input:%q", evaluated, evaluated, tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	inspects := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"[]", "[]"},
+		{"let a = [1, 2, 3, 4]; a[1:3]", "[2, 3]"},
+		{"let a = [1, 2, 3, 4]; a[:-1]", "[1, 2, 3]"},
+		{"let a = [1, 2, 3, 4]; a[-2:]", "[3, 4]"},
+		{"let a = [1, 2, 3, 4]; a[:]", "[1, 2, 3, 4]"},
+		{"let a = [1, 2]; a[2:]", "[]"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-1]`, "o"},
+		{"[[1, 2], [3]][0]", "[1, 2]"},
+	}
+
+	for _, tt := range inspects {
+		if actual := testEval(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	integers := []struct {
+		input    string
+		expected int64
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let a = [1, 2, 3]; a[0] + a[1] + a[2]", 6},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"let first = fun(a) { a[0] }; first([7, 8])", 7},
+		{"[fun(x) { x * 2 }][0](21)", 42},
+	}
+
+	for _, tt := range integers {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		pos             string
+	}{
+		{"[1, 2, 3][3]", "index out of range: 3 with length 3", "1:11"},
+		{"let a = [1]\na[-2]", "index out of range: -2 with length 1", "2:3"},
+		{`"ab"[5]`, "index out of range: 5 with length 2", "1:6"},
+		{"[1][true]", "index must be INTEGER, got BOOLEAN", "1:5"},
+		{"1[0]", "index operator not supported: INTEGER", "1:3"},
+		{"[1, 2][1:5]", "slice bounds out of range: [1:5] with length 2", "1:1"},
+		{"[1, 2][2:1]", "slice bounds out of range: [2:1] with length 2", "1:1"},
+		{"[1, 2][\"a\":]", "slice bound must be INTEGER, got STRING", "1:8"},
+		{"true[:]", "slice operator not supported: BOOLEAN", "1:1"},
+		{"[1, -true]", "unknown operator: -BOOLEAN", "1:5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) input:%q", evaluated, evaluated, tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+
+		if errObj.Pos.String() != tt.pos {
+			t.Errorf("wrong error position. expected=%s, got=%s input:%q", tt.pos, errObj.Pos, tt.input)
+		}
+	}
+}
+
+func TestHashes(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	hash, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(hash.Pairs))
+	}
+
+	for i, tt := range expected {
+		if hash.Pairs[i].Key.Inspect() != tt.key.Inspect() {
+			t.Errorf("keys[%d] wrong. expected=%s", i, tt.key.Inspect())
+		}
+
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Errorf("no pair for key %s", tt.key.Inspect())
+			continue
+		}
+
+		testIntegerObject(t, value, tt.value)
+	}
+
+	if hash.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("Inspect() wrong. got=%q", hash.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 1, 1: 2}[1]`, 2},
+		{`let h = {"f": fun(x) { x * 2 }}; h["f"](3)`, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v) input:%q", evaluated, evaluated, tt.input)
+		}
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		pos             string
+	}{
+		{`{"name": "z"}[fun(x) { x }]`, "unusable as hash key: FUNCTION", "1:15"},
+		{`{fun(x) { x }: 1}`, "unusable as hash key: FUNCTION", "1:2"},
+		{"let h = {}\nh[[1]]", "unusable as hash key: ARRAY", "2:3"},
+		{`{1.5: 1}`, "unusable as hash key: FLOAT", "1:2"},
+		{`{"a": -true}`, "unknown operator: -BOOLEAN", "1:7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) input:%q", evaluated, evaluated, tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+
+		if errObj.Pos.String() != tt.pos {
+			t.Errorf("wrong error position. expected=%s, got=%s input:%q", tt.pos, errObj.Pos, tt.input)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sum = fun(n) { let i = 0; let s = 0; while true { if i > n { break } s = s + i; i = i + 1 }; s }; sum(10)", "55"},
+		{"let f = fun() { for let i = 0; i < 10; let i = i + 1 { if i == 3 { return i } } }; f()", "3"},
+		{"let f = fun() { for let i = 0; ; let i = i + 1 { if i * i > 50 { return i } } }; f()", "8"},
+		{"let last = 0; for x in [1, 2, 3] { if x == 2 { continue } let last = x }; last", "0"},
+		{"let f = fun(xs) { for x in xs { if x > 1 { return x } } }; f([1, 5, 9])", "5"},
+		{`let f = fun(h) { for k in h { if h[k] == 2 { return k } } }; f({"a": 1, "b": 2})`, "b"},
+		{`let f = fun(s) { for c in s { if c != "h" { return c } } }; f("héllo")`, "é"},
+		{"let f = fun() { for i in 5 { if i == 4 { return i } } }; f()", "4"},
+		{"for i in 0 { i }", "null"},
+		{"for i in -1 { i }", "null"},
+		{"while false { 1 }", "null"},
+		{"let fs = fun() { let r = {}; for i in 3 { let g = fun() { i } }; g() }; fs()", "ERROR: 1:66: identifier not found: g"},
+		{"let f = fun() { let a = [0]; for i in 3 { let a = a[0:1] }; a }; f()", "[0]"},
+		{"let f = fun() { while true { while true { break } return 7 } }; f()", "7"},
+		{"for i in true { i }", "ERROR: 1:10: cannot iterate over BOOLEAN"},
+		{"while 1 + true { 1 }", "ERROR: 1:7: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fun() { let x = if true { return 5 }; 6 }; f()", "5"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestLoopClosures(t *testing.T) {
+	input := `
+	let make = fun() {
+		for x in [10, 20, 30] {
+			let f = fun() { x }
+			if x == 20 { return f }
+		}
+	}
+	make()()`
+
+	testIntegerObject(t, testEval(t, input), 20)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = 2; x", "2"},
+		{"let x = 1; x = 2", "2"},
+		{"let x = 1; let y = 1; x = y = 5; x + y", "10"},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", "6"},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let x = 1; x += 0.5; x", "1.5"},
+		{"let a = [1, 2, 3]; a[0] = 9; a[-1] += 10; a", "[9, 2, 13]"},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h`, "{a: 11, b: 2}"},
+		{"let a = [[1], [2]]; a[1][0] = 5; a", "[[1], [5]]"},
+		{"let a = [1]; let b = a; b[0] = 2; a", "[2]"},
+		{"let n = 0; let inc = fun() { n += 1 }; inc(); inc(); n", "2"},
+		{"let n = 0; let f = fun(n) { n = 5 }; f(1); n", "0"},
+		{"let sum = 0; for let i = 0; i < 5; i = i + 1 { sum += i }; sum", "10"},
+		{"let sum = 0; for let i = 0; i < 5; i += 1 { if i == 3 { continue } sum += i }; sum", "7"},
+		{"let i = 0; while i < 3 { i += 1 }; i", "3"},
+		{"let c = 0; for ch in \"héllo\" { c += 1 }; c", "5"},
+		{"let calls = 0; let key = fun() { calls += 1; 0 }; let a = [1]; a[key()] += 1; calls", "1"},
+		{"let fs = {}; for i in 3 { fs[i] = fun() { i } }; fs[0]() * 100 + fs[1]() * 10 + fs[2]()", "12"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		pos             string
+	}{
+		{"x = 1", "assignment to undeclared variable: x", "1:1"},
+		{"let f = fun() { y = 1 }; f()", "assignment to undeclared variable: y", "1:17"},
+		{"x += 1", "identifier not found: x", "1:1"},
+		{"let x = true; x += 1", "type mismatch: BOOLEAN + INTEGER", "1:15"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 with length 1", "1:16"},
+		{"let a = [1]; a[\"k\"] = 2", "index must be INTEGER, got STRING", "1:16"},
+		{"let h = {}; h[[1]] = 2", "unusable as hash key: ARRAY", "1:15"},
+		{"let s = \"ab\"; s[0] = \"c\"", "index assignment not supported: STRING", "1:17"},
+		{"let h = {}; h[\"a\"] += 1", "type mismatch: NULL + INTEGER", "1:13"},
+		{"let x = 1; x = -true", "unknown operator: -BOOLEAN", "1:16"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) input:%q", evaluated, evaluated, tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+
+		if errObj.Pos.String() != tt.pos {
+			t.Errorf("wrong error position. expected=%s, got=%s input:%q", tt.pos, errObj.Pos, tt.input)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	testIntegerObject(t, testEval(t, "const a = 5; let f = fun() { let a = 1; a = 2; a }; a + f()"), 7)
+	testIntegerObject(t, testEval(t, "const a = [1]; a[0] = 3; a[0]"), 3)
+
+	// the REPL parses every line on its own, so the evaluator has to check
+	// what the checker cannot see
+	tests := []struct {
+		lines           []string
+		expectedMessage string
+	}{
+		{[]string{"const a = 1", "a = 2"}, "cannot assign to constant a"},
+		{[]string{"const a = 1", "a += 2"}, "cannot assign to constant a"},
+		{[]string{"const a = 1", "let a = 2"}, "cannot redeclare constant a"},
+		{[]string{"const a = 1", "const a = 2"}, "cannot redeclare constant a"},
+		{[]string{"let f = fun() { b = 1 }", "const b = 0", "f()"}, "cannot assign to constant b"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		var evaluated object.Object
+		for _, line := range tt.lines {
+			p := parser.New(lexer.New(line))
+			program := p.ParseProgram()
+			checkParserErrors(t, p, line)
+			evaluated = Eval(program, env)
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) lines:%q", evaluated, evaluated, tt.lines)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// every block and every run of a loop body is a scope of its own
+	scoped := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; let s = 0; while i < 3 { const c = i; s += c; i += 1 }; s", 3},
+		{"let s = 0; for let j = 0; j < 3; j += 1 { const c = j; s += c }; s", 3},
+		{"let s = 0; for x in 3 { const c = x; s += c }; s", 3},
+		{"let f = fun(x) { if x == 1 { const y = 2; y } else { const y = 3; y } }; f(1) + f(2)", 5},
+		{"const a = 1; if true { const a = 2 }; a", 1},
+	}
+
+	for _, tt := range scoped {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New("const a = 1")).ParseProgram(), env)
+	if evaluated := Eval(parser.New(lexer.New("let f = fun() { let a = 2; a }; f()")).ParseProgram(), env); evaluated.Inspect() != "2" {
+		t.Errorf("shadowing in a function failed. got=%s", evaluated.Inspect())
+	}
+}
+
+func checkParserErrors(t *testing.T, p *parser.Parser, input string) {
+	for _, err := range p.Errors() {
+		t.Errorf("parse error: %q input:%q", err, input)
+	}
+}
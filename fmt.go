@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abusizhishen/zlang/diagnostic"
+	"github.com/abusizhishen/zlang/format"
+)
+
+// usage: zlang fmt [-w] [files...]
+//
+// fmt prints the files in canonical form, or overwrites them with it for -w.
+// Without files it formats standard input.
+func fmtCmd(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: zlang fmt [-w] [files...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "zlang fmt: cannot use -w with standard input")
+			return 2
+		}
+
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		return formatFile("<stdin>", src, false)
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		if s := formatFile(filename, src, *write); s != 0 {
+			status = s
+		}
+	}
+
+	return status
+}
+
+func formatFile(filename string, src []byte, write bool) int {
+	res, err := format.Source(filename, src)
+	if err != nil {
+		if errs, ok := err.(diagnostic.ErrorList); ok {
+			errs.WriteText(os.Stderr, string(src))
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		return 1
+	}
+
+	if !write {
+		os.Stdout.Write(res)
+		return 0
+	}
+
+	if bytes.Equal(res, src) {
+		return 0
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
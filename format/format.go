@@ -0,0 +1,639 @@
+// Package format prints zlang syntax trees as canonical source code.
+//
+// Statements go on lines of their own, blocks are indented with one tab per
+// level and binary operators are surrounded by spaces. Parentheses are only
+// printed where the precedence of the parser requires them, so redundant ones
+// written in the source are dropped. Comments of a Program are printed at
+// their place between statements; an array, hash or argument list with
+// comments inside is printed with one element per line.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+	"github.com/abusizhishen/zlang/token"
+)
+
+// atom is the precedence of expressions that never need parentheses, such
+// as literals and names.
+const atom = parser.INDEX + 1
+
+// Source parses src, the content of the file filename, and returns it in
+// canonical form. Syntax errors are returned as a diagnostic.ErrorList.
+func Source(filename string, src []byte) ([]byte, error) {
+	l := lexer.NewFile(filename, string(src))
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Node(&buf, program); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Node writes the canonical source of node to w. A Program ends with a
+// newline and carries its comments along; other nodes are printed without
+// comments. Trees with *ast.BadStatement or *ast.BadExpression nodes, which
+// the parser leaves behind on errors, can't be printed.
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	if err := p.print(node); err != nil {
+		return err
+	}
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+type printer struct {
+	out       bytes.Buffer
+	indent    int
+	lineStart bool // nothing was written on the current line yet
+
+	comments []*ast.Comment
+	next     int // index of the first comment not printed yet
+	line     int // source line printed last, 0 at the start of a block
+}
+
+// bailout is the panic value print uses to abort on unprintable trees.
+type bailout struct{ err error }
+
+func (p *printer) print(node ast.Node) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, ok := r.(bailout)
+			if !ok {
+				panic(r)
+			}
+
+			err = b.err
+		}
+	}()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+		p.lineStart = true
+		p.stmtList(node.Statements)
+		p.flushComments(-1)
+	case ast.Statement:
+		p.stmt(node)
+	case ast.Expression:
+		p.expr(node, parser.LOWEST)
+	case *ast.SwitchCase:
+		p.switchCase(node)
+	default:
+		p.errorf("cannot format %T", node)
+	}
+
+	return nil
+}
+
+func (p *printer) errorf(format string, args ...interface{}) {
+	panic(bailout{fmt.Errorf("format: "+format, args...)})
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart && s != "" {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.lineStart = false
+	}
+
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.lineStart = true
+}
+
+// blankLine keeps one empty line before something starting at source line
+// line when the source had at least one there.
+func (p *printer) blankLine(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+}
+
+// flushComments prints the comments that start before offset on lines of
+// their own, all remaining comments for offset -1.
+func (p *printer) flushComments(offset int) {
+	for ; p.next < len(p.comments); p.next++ {
+		c := p.comments[p.next]
+		if offset >= 0 && c.Pos().Offset >= offset {
+			return
+		}
+
+		p.blankLine(c.Pos().Line)
+		p.write(c.Text())
+		p.newline()
+		p.line = c.End().Line
+	}
+}
+
+// trailingComments prints the comments inside of a statement or list
+// element that were not printed with one of its blocks, and the comments
+// after it on its last line, at the end of the line. Comments starting at
+// limit or later are left alone, unless limit is -1.
+func (p *printer) trailingComments(end token.Position, limit int) {
+	for ; p.next < len(p.comments); p.next++ {
+		c := p.comments[p.next]
+		if c.Pos().Offset >= end.Offset && c.Pos().Line != end.Line {
+			return
+		}
+
+		if limit >= 0 && c.Pos().Offset >= limit {
+			return
+		}
+
+		if p.lineStart {
+			// the previous comment was a // comment
+			p.write(c.Text())
+		} else {
+			p.write(" " + c.Text())
+		}
+
+		if strings.HasPrefix(c.Text(), "//") {
+			p.newline()
+		}
+
+		p.line = c.End().Line
+	}
+}
+
+func (p *printer) hasCommentBefore(offset int) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Pos().Offset < offset
+}
+
+// hasCommentIn reports whether a comment not printed yet starts at or after
+// from and before to.
+func (p *printer) hasCommentIn(from, to int) bool {
+	for _, c := range p.comments[p.next:] {
+		if c.Pos().Offset >= to {
+			return false
+		}
+
+		if c.Pos().Offset >= from {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *printer) stmtList(list []ast.Statement) {
+	for _, s := range list {
+		p.flushComments(s.Pos().Offset)
+		p.blankLine(s.Pos().Line)
+		p.stmt(s)
+		p.trailingComments(s.End(), -1)
+		if !p.lineStart {
+			p.newline()
+		}
+
+		if line := s.End().Line; line > p.line {
+			p.line = line
+		}
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	p.write("{")
+	if len(b.Statements) == 0 && !p.hasCommentBefore(b.Rbrace.Pos.Offset) {
+		p.write("}")
+		return
+	}
+
+	p.indent++
+	p.newline()
+	p.line = 0
+	p.stmtList(b.Statements)
+	p.flushComments(b.Rbrace.Pos.Offset)
+	p.indent--
+	p.write("}")
+	p.line = b.Rbrace.End.Line
+}
+
+func (p *printer) stmt(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		p.expr(s.Expression, parser.LOWEST)
+	case *ast.LetStatement:
+		p.binding("let", s.Name, s.Value)
+	case *ast.ConstStatement:
+		p.binding("const", s.Name, s.Value)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expr(s.ReturnValue, parser.LOWEST)
+		}
+	case *ast.BranchStatement:
+		p.write(s.Token.Literal)
+	case *ast.BlockStatement:
+		p.block(s)
+	case *ast.IfExpress:
+		p.ifExpr(s)
+	case *ast.WhileStatement:
+		p.write("while ")
+		p.headExpr(s.Condition)
+		p.write(" ")
+		p.block(s.Body)
+	case *ast.ForStatement:
+		p.write("for ")
+		if s.Init != nil {
+			p.stmt(s.Init)
+		}
+
+		p.write(";")
+		if s.Condition != nil {
+			p.write(" ")
+			p.expr(s.Condition, parser.LOWEST)
+		}
+
+		p.write(";")
+		if s.Post != nil {
+			p.write(" ")
+			if post, ok := s.Post.(*ast.ExpressionStatement); ok {
+				p.headExpr(post.Expression)
+			} else {
+				p.stmt(s.Post)
+			}
+		}
+
+		p.write(" ")
+		p.block(s.Body)
+	case *ast.ForInStatement:
+		p.write("for " + s.Variable.Value + " in ")
+		p.headExpr(s.Iterable)
+		p.write(" ")
+		p.block(s.Body)
+	case nil:
+		p.errorf("missing statement")
+	default:
+		p.errorf("cannot format %T", s)
+	}
+}
+
+func (p *printer) binding(keyword string, name *ast.Identifier, value ast.Expression) {
+	p.write(keyword + " " + name.Value + " = ")
+	p.expr(value, parser.LOWEST)
+}
+
+// headExpr prints an expression that is followed by a block, parenthesizing
+// it when it starts with a hash literal the parser would take for the block.
+func (p *printer) headExpr(x ast.Expression) {
+	if _, ok := leftmost(x).(*ast.HashLiteral); ok {
+		p.write("(")
+		p.expr(x, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	p.expr(x, parser.LOWEST)
+}
+
+// leftmost returns the operand x is printed to start with: x itself or,
+// for an operation printed without parentheses, its leftmost operand.
+func leftmost(x ast.Expression) ast.Expression {
+	for {
+		x = unparen(x)
+		var left ast.Expression
+		prec := precedence(x)
+		switch y := x.(type) {
+		case *ast.InfixExpression:
+			left = y.Left
+		case *ast.AssignExpression:
+			left, prec = y.Target, parser.ASSIGN+1
+		case *ast.CallExpression:
+			left = y.Function
+		case *ast.IndexExpression:
+			left = y.Left
+		case *ast.SliceExpression:
+			left = y.Left
+		default:
+			return x
+		}
+
+		if left == nil || precedence(left) < prec {
+			// printed in parentheses
+			return x
+		}
+
+		x = left
+	}
+}
+
+// unparen returns x without the parentheses around it.
+func unparen(x ast.Expression) ast.Expression {
+	for {
+		group, ok := x.(*ast.GroupExpress)
+		if !ok {
+			return x
+		}
+
+		x = group.Express
+	}
+}
+
+// precedence returns how tightly x binds, so that x needs parentheses
+// wherever a higher precedence is required.
+func precedence(x ast.Expression) int {
+	switch x := unparen(x).(type) {
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(x.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.IntegerLiteral:
+		// a negative literal token is -9223372036854775808, which
+		// the parser folds into one literal
+		if x.Value < 0 {
+			return parser.PREFIX
+		}
+	case *ast.FloatLiteral:
+		if x.Value < 0 && !literalToken(x.Token, token.Float) {
+			return parser.PREFIX
+		}
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		return parser.CALL
+	}
+
+	return atom
+}
+
+// literalToken reports whether tok is the source of a literal of type t,
+// rather than missing from a node built in code.
+func literalToken(tok token.Token, t token.TokenType) bool {
+	return tok.Type == t && tok.Literal != ""
+}
+
+// expr prints x, in parentheses if it binds less tightly than prec.
+func (p *printer) expr(x ast.Expression, prec int) {
+	x = unparen(x)
+	if x == nil {
+		p.errorf("missing expression")
+	}
+
+	if precedence(x) < prec {
+		p.write("(")
+		p.expr(x, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch x := x.(type) {
+	case *ast.Identifier:
+		p.write(x.Value)
+	case *ast.IntegerLiteral:
+		if literalToken(x.Token, token.Integer) {
+			p.write(x.Token.Literal)
+		} else {
+			p.write(strconv.FormatInt(x.Value, 10))
+		}
+	case *ast.FloatLiteral:
+		if literalToken(x.Token, token.Float) {
+			p.write(x.Token.Literal)
+		} else {
+			p.write(formatFloat(x.Value))
+		}
+	case *ast.StringLiteral:
+		p.write(x.String())
+	case *ast.ConcatExpression:
+		p.write(`"`)
+		for _, part := range x.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok {
+				quoted := text.String()
+				p.write(quoted[1 : len(quoted)-1])
+				continue
+			}
+
+			p.write("${")
+			p.expr(part, parser.LOWEST)
+			p.write("}")
+		}
+
+		p.write(`"`)
+	case *ast.Bool:
+		p.write(strconv.FormatBool(x.Value))
+	case *ast.PrefixExpression:
+		p.write(x.Operator)
+		p.expr(x.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(x)
+		p.expr(x.Left, prec)
+		p.write(" " + x.Operator + " ")
+		p.expr(x.Right, prec+1)
+	case *ast.AssignExpression:
+		p.expr(x.Target, parser.ASSIGN+1)
+		p.write(" " + x.Operator + " ")
+		p.expr(x.Value, parser.ASSIGN)
+	case *ast.IfExpress:
+		p.ifExpr(x)
+	case *ast.SwitchExpression:
+		p.switchExpr(x)
+	case *ast.FunctionLiteral:
+		names := make([]string, len(x.Parameters))
+		for i, param := range x.Parameters {
+			names[i] = param.Value
+		}
+
+		p.write("fun(" + strings.Join(names, ", ") + ") ")
+		p.block(x.Body)
+	case *ast.CallExpression:
+		p.expr(x.Function, parser.CALL)
+		p.write("(")
+		p.exprList(x.Token, x.Rparen, x.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.exprList(x.Token, x.Rbracket, x.Elements)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		spans := make([]span, len(x.Pairs))
+		for i, pair := range x.Pairs {
+			spans[i] = span{pair.Key.Pos(), pair.Value.End()}
+		}
+
+		p.list(x.Token, x.Rbrace, spans, func(i int) {
+			p.expr(x.Pairs[i].Key, parser.LOWEST)
+			p.write(": ")
+			p.expr(x.Pairs[i].Value, parser.LOWEST)
+		})
+		p.write("}")
+	case *ast.IndexExpression:
+		p.expr(x.Left, parser.CALL)
+		p.write("[")
+		p.expr(x.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.expr(x.Left, parser.CALL)
+		p.write("[")
+		if x.Low != nil {
+			p.expr(x.Low, parser.LOWEST)
+		}
+
+		p.write(":")
+		if x.High != nil {
+			p.expr(x.High, parser.LOWEST)
+		}
+
+		p.write("]")
+	default:
+		p.errorf("cannot format %T", x)
+	}
+}
+
+// span is the source range of a list element.
+type span struct {
+	pos, end token.Position
+}
+
+func (p *printer) exprList(open, close token.Token, list []ast.Expression) {
+	spans := make([]span, len(list))
+	for i, x := range list {
+		if x != nil {
+			spans[i] = span{x.Pos(), x.End()}
+		}
+	}
+
+	p.list(open, close, spans, func(i int) { p.expr(list[i], parser.LOWEST) })
+}
+
+// list prints the elements between the brackets open and close, calling
+// item for each of them. The elements are separated by commas on one line
+// unless a comment sits between the brackets: then every element goes on a
+// line of its own, followed by the comments at its end.
+func (p *printer) list(open, close token.Token, spans []span, item func(i int)) {
+	if !p.hasCommentIn(open.End.Offset, close.Pos.Offset) {
+		for i := range spans {
+			if i > 0 {
+				p.write(", ")
+			}
+
+			item(i)
+		}
+
+		return
+	}
+
+	p.indent++
+	p.newline()
+	p.line = 0
+	for i, s := range spans {
+		p.flushComments(s.pos.Offset)
+		item(i)
+		limit := close.Pos.Offset
+		if i < len(spans)-1 {
+			p.write(",")
+			limit = spans[i+1].pos.Offset
+		}
+
+		p.trailingComments(s.end, limit)
+		if !p.lineStart {
+			p.newline()
+		}
+
+		p.line = s.end.Line
+	}
+
+	p.flushComments(close.Pos.Offset)
+	p.indent--
+	p.line = close.End.Line
+}
+
+func (p *printer) ifExpr(x *ast.IfExpress) {
+	p.write("if ")
+	p.headExpr(x.Condition)
+	p.write(" ")
+	p.block(x.TrueStatement)
+
+	switch e := x.ElseStatement.(type) {
+	case nil:
+	case *ast.IfExpress:
+		p.write(" else ")
+		p.ifExpr(e)
+	case *ast.BlockStatement:
+		p.write(" else ")
+		p.block(e)
+	default:
+		p.errorf("cannot format %T as else branch", e)
+	}
+}
+
+func (p *printer) switchExpr(x *ast.SwitchExpression) {
+	p.write("switch ")
+	if x.Value != nil {
+		p.headExpr(x.Value)
+		p.write(" ")
+	}
+
+	p.write("{")
+	if len(x.Cases) == 0 && x.Default == nil && !p.hasCommentBefore(x.Rbrace.Pos.Offset) {
+		p.write("}")
+		return
+	}
+
+	p.newline()
+	p.line = 0
+	for _, c := range x.Cases {
+		p.flushComments(c.Pos().Offset)
+		p.blankLine(c.Pos().Line)
+		p.switchCase(c)
+		p.newline()
+	}
+
+	if x.Default != nil {
+		p.flushComments(x.Default.Pos().Offset)
+		p.blankLine(x.Default.Pos().Line)
+		p.write("default ")
+		p.block(x.Default)
+		p.newline()
+	}
+
+	p.flushComments(x.Rbrace.Pos.Offset)
+	p.write("}")
+	p.line = x.Rbrace.End.Line
+}
+
+func (p *printer) switchCase(c *ast.SwitchCase) {
+	p.write("case ")
+	for i, v := range c.Values {
+		if i > 0 {
+			p.write(", ")
+			p.expr(v, parser.LOWEST)
+			continue
+		}
+
+		// only a { right after case is taken for the body
+		p.headExpr(v)
+	}
+
+	p.write(" ")
+	p.block(c.Body)
+}
+
+// formatFloat prints f so that it reads back as a float.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+
+	return s
+}
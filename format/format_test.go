@@ -0,0 +1,274 @@
+package format
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/parser"
+	"github.com/abusizhishen/zlang/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a=1+2*3", "let a = 1 + 2 * 3\n"},
+		{"let a = 1; let b = 2;", "let a = 1\nlet b = 2\n"},
+		{"x+=1;y=x", "x += 1\ny = x\n"},
+		{"a = b = -c", "a = b = -c\n"},
+		{"!(a&&b)||c", "!(a && b) || c\n"},
+		{"(1 + 2) * 3", "(1 + 2) * 3\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3)\n"},
+		{"((1+2))", "1 + 2\n"},
+		{"(a)", "a\n"},
+		{"let b = ((1 + 2)) * (3)", "let b = (1 + 2) * 3\n"},
+		{"(-1)[0] + (f)(x)", "(-1)[0] + f(x)\n"},
+		{"0x1F + 1_000 + 2.50", "0x1F + 1_000 + 2.50\n"},
+		{"(-9223372036854775808)[0] - -0x8000000000000000", "(-9223372036854775808)[0] - -0x8000000000000000\n"},
+		{`"a\tb" + "${x}\${y}\"${f("z")}"`, `"a\tb" + "${x}\${y}\"${f("z")}"` + "\n"},
+		{"f(a,b)[0][1:][:2][:]", "f(a, b)[0][1:][:2][:]\n"},
+		{"[1,[2,3],{}]", "[1, [2, 3], {}]\n"},
+		{`{"a":1,2:true}`, `{"a": 1, 2: true}` + "\n"},
+		{"let f = fun(x,y){return x+y}", "let f = fun(x, y) {\n\treturn x + y\n}\n"},
+		{"fun(){}", "fun() {}\n"},
+		{"fun(){ return }", "fun() {\n\treturn\n}\n"},
+		{"if (a) { b } else if c { d } else { e }", "if a {\n\tb\n} else if c {\n\td\n} else {\n\te\n}\n"},
+		{`if ({"a": 1}) { b }`, "if ({\"a\": 1}) {\n\tb\n}\n"},
+		{"let v = if a { 1 } else { 2 }", "let v = if a {\n\t1\n} else {\n\t2\n}\n"},
+		{"while x<3 { x+=1; if x == 2 { break } }", "while x < 3 {\n\tx += 1\n\tif x == 2 {\n\t\tbreak\n\t}\n}\n"},
+		{"for let i=0;i<3;i+=1 { continue }", "for let i = 0; i < 3; i += 1 {\n\tcontinue\n}\n"},
+		{"for ; ; { }", "for ;; {}\n"},
+		{"for ; i < 3; { i }", "for ; i < 3; {\n\ti\n}\n"},
+		{`for k in ({"a": 1}) { k }`, "for k in ({\"a\": 1}) {\n\tk\n}\n"},
+		{`while ((({"a": 1}))) { }`, "while ({\"a\": 1}) {}\n"},
+		{`while ({"a": 1}["a"] == 2) { }`, "while ({\"a\": 1}[\"a\"] == 2) {}\n"},
+		{`switch ({"a": 1}["a"] + 1) { case 1 { } }`, "switch ({\"a\": 1}[\"a\"] + 1) {\ncase 1 {}\n}\n"},
+		{`let v = ({"a": 1} + 1) * 2`, "let v = ({\"a\": 1} + 1) * 2\n"},
+		{"switch x { case 1, 2 { a } default { b } }", "switch x {\ncase 1, 2 {\n\ta\n}\ndefault {\n\tb\n}\n}\n"},
+		{"switch { }", "switch {}\n"},
+		{"map(xs, fun(x) { x * 2 })", "map(xs, fun(x) {\n\tx * 2\n})\n"},
+		{"const limit = 10", "const limit = 10\n"},
+		{"const a = 1; a = 2", "const a = 1\na = 2\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("test.zl", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %v", tt.input, err)
+			continue
+		}
+
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// head\nlet a = 1 // one\n\n\n/* two */ let b = 2\n// tail", "// head\nlet a = 1 // one\n\n/* two */\nlet b = 2\n// tail\n"},
+		{"fun() {\n  // inside\n  x /* end */\n  // last\n}", "fun() {\n\t// inside\n\tx /* end */\n\t// last\n}\n"},
+		{"if a {\n// only\n}", "if a {\n\t// only\n}\n"},
+		{"let a = [1, // one\n2, // two\n3]", "let a = [\n\t1, // one\n\t2, // two\n\t3\n]\n"},
+		{"let h = {\n// first\n\"a\": 1, /* one */ 2: 2\n}", "let h = {\n\t// first\n\t\"a\": 1, /* one */\n\t2: 2\n}\n"},
+		{"f(a, [1, 2] // list\n)", "f(\n\ta,\n\t[1, 2] // list\n)\n"},
+		{"switch x {\n// first\ncase 1 { a }\n// none\n}", "switch x {\n// first\ncase 1 {\n\ta\n}\n// none\n}\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("test.zl", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %v", tt.input, err)
+			continue
+		}
+
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// roundTrip covers every statement and expression with comments in between.
+const roundTrip = `// Package comment.
+let a = -1 + 2 * 3.5e2 // trailing
+const s = "x${a + 1}y\n"
+
+/* block
+   comment */
+let f = fun(x, y) {
+	// first
+	return x[0:1] + y[:]
+
+}
+let h = {"k": [1, true, !false], 2: (a)}
+let l = [
+	((1)), // one
+	2 /* two */, f(
+		// x
+		3)]
+if (a < 2) { a += 1 } else if a { f(a, h)(1) } else { a }
+let r = switch a { case 1, ({"x": 1}) { a } default { h["k"][0] = 3 } }
+while a { break; }
+for let i = 0; i < 3; i = i + 1 { continue }
+for ; ; { return }
+for v in ({1: 2}) { v }
+while ({"a": 1}["a"] == 2) { }
+if ({"a": 1}["a"] + 1 > 0) { } else if ({})[0] { }
+switch ({1: 2})[1] { case ({2: 3})[2] + 1, 4 { } }
+for k in ({1: 2})[1:] { }
+for ; ; ({"a": 1})["a"] = 2 { break }
+a = b = (c = 1) + 2
+-(1 - 2) - -3
+`
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	l := lexer.NewFile("test.zl", src)
+	l.SetMode(lexer.ScanComments)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v\n%s", p.Errors(), src)
+	}
+
+	return program
+}
+
+// stripPositions zeroes every token and position in the tree at v, leaving
+// what the formatter has to preserve.
+func stripPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			stripPositions(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			stripPositions(v.Index(i))
+		}
+	case reflect.Struct:
+		switch v.Type() {
+		case reflect.TypeOf(token.Token{}), reflect.TypeOf(token.Position{}):
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			stripPositions(v.Field(i))
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	sources := []string{roundTrip}
+	for _, tt := range []string{"let x = 1", "if a { b }", "fun() {}(1)[2]"} {
+		sources = append(sources, tt)
+	}
+
+	for _, src := range sources {
+		program := parse(t, src)
+
+		var buf bytes.Buffer
+		if err := Node(&buf, program); err != nil {
+			t.Fatalf("Node failed: %v", err)
+		}
+
+		formatted := parse(t, buf.String())
+		if len(formatted.Comments) != len(program.Comments) {
+			t.Errorf("comments lost. expected=%d, got=%d\n%s", len(program.Comments), len(formatted.Comments), buf.String())
+		}
+
+		for i := range program.Comments {
+			if i < len(formatted.Comments) && formatted.Comments[i].Text() != program.Comments[i].Text() {
+				t.Errorf("comment %d wrong. expected=%q, got=%q", i, program.Comments[i].Text(), formatted.Comments[i].Text())
+			}
+		}
+
+		// the formatter drops redundant parentheses
+		ungroup := func(n ast.Node) ast.Node {
+			if group, ok := n.(*ast.GroupExpress); ok {
+				return group.Express
+			}
+
+			return n
+		}
+
+		ast.Modify(program, ungroup)
+		ast.Modify(formatted, ungroup)
+		stripPositions(reflect.ValueOf(program))
+		stripPositions(reflect.ValueOf(formatted))
+		if !reflect.DeepEqual(formatted.Statements, program.Statements) {
+			t.Errorf("formatted source parses to a different tree.\nsource:\n%s\nformatted:\n%s", src, buf.String())
+		}
+
+		again, err := Source("test.zl", buf.Bytes())
+		if err != nil {
+			t.Fatalf("Source failed: %v", err)
+		}
+
+		if string(again) != buf.String() {
+			t.Errorf("formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", buf.String(), again)
+		}
+	}
+}
+
+func TestNodeParentheses(t *testing.T) {
+	ident := func(name string) ast.Expression { return &ast.Identifier{Value: name} }
+	infix := func(l ast.Expression, op string, r ast.Expression) ast.Expression {
+		return &ast.InfixExpression{Left: l, Operator: op, Right: r}
+	}
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{infix(infix(ident("a"), "+", ident("b")), "*", ident("c")), "(a + b) * c"},
+		{infix(ident("a"), "*", infix(ident("b"), "+", ident("c"))), "a * (b + c)"},
+		{infix(infix(ident("a"), "-", ident("b")), "-", ident("c")), "a - b - c"},
+		{infix(ident("a"), "-", infix(ident("b"), "-", ident("c"))), "a - (b - c)"},
+		{infix(ident("a"), "||", infix(ident("b"), "&&", ident("c"))), "a || b && c"},
+		{&ast.PrefixExpression{Operator: "-", Right: infix(ident("a"), "+", ident("b"))}, "-(a + b)"},
+		{&ast.CallExpression{Function: &ast.PrefixExpression{Operator: "!", Right: ident("f")}}, "(!f)()"},
+		{&ast.IndexExpression{Left: infix(ident("a"), "+", ident("b")), Index: &ast.IntegerLiteral{Value: 0}}, "(a + b)[0]"},
+		{infix(&ast.AssignExpression{Target: ident("a"), Operator: "=", Value: ident("b")}, "+", ident("c")), "(a = b) + c"},
+		{&ast.IndexExpression{Left: &ast.IntegerLiteral{Value: -1}, Index: &ast.FloatLiteral{Value: 2}}, "(-1)[2.0]"},
+		{&ast.WhileStatement{Condition: &ast.HashLiteral{}, Body: &ast.BlockStatement{}}, "while ({}) {}"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Node(&buf, tt.node); err != nil {
+			t.Errorf("Node(%s) failed: %v", tt.node, err)
+			continue
+		}
+
+		if buf.String() != tt.expected {
+			t.Errorf("Node wrong. expected=%q, got=%q", tt.expected, buf.String())
+		}
+	}
+}
+
+func TestNodeErrors(t *testing.T) {
+	l := lexer.New("let a = )")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	var buf bytes.Buffer
+	err := Node(&buf, program)
+	if err == nil || !strings.Contains(err.Error(), "*ast.BadExpression") {
+		t.Errorf("expected error for bad expression, got %v", err)
+	}
+
+	if _, err := Source("test.zl", []byte("let = 1")); err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
@@ -1,93 +1,303 @@
 package lexer
 
-import "github.com/abusizhishen/zlang/token"
+import (
+	"bytes"
+	"fmt"
+	"github.com/abusizhishen/zlang/diagnostic"
+	"github.com/abusizhishen/zlang/token"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mode controls optional lexer behavior.
+type Mode uint
+
+const (
+	// ScanComments makes NextToken return comments as token.Comment
+	// instead of skipping them.
+	ScanComments Mode = 1 << iota
+)
+
+// bufSize is the initial size of the buffer of a lexer reading from an
+// io.Reader. It only grows when a single token does not fit.
+const bufSize = 4096
 
 type Lexer struct {
-	input        string
-	readPosition int
-	position     int
-	ch           byte
+	src          io.Reader // nil when the whole input is in buf
+	buf          []byte    // input from offset base on
+	base         int       // offset of buf[0] in the input
+	mark         int       // offset of the first byte that must stay in buf
+	eof          bool      // src is exhausted
+	filename     string
+	mode         Mode
+	readPosition int // offset in the input, not in buf
+	position     int // offset in the input, not in buf
+	ch           rune
+	line         int   // line of ch
+	column       int   // column of ch, counted in runes
+	interp       []int // brace depth of every open ${ } interpolation
+	errors       diagnostic.ErrorList
 }
 
 func New(string2 string) *Lexer {
-	lex := &Lexer{input: string2}
+	return NewFile("", string2)
+}
+
+// NewFile is like New but records filename in the position of every token.
+func NewFile(filename, input string) *Lexer {
+	lex := &Lexer{buf: []byte(input), eof: true, filename: filename, line: 1}
+	lex.readChar()
+	return lex
+}
+
+// NewReader returns a lexer that reads src incrementally, keeping only the
+// input of the token being scanned in memory. filename is recorded in the
+// position of every token.
+//
+// The parser pulls tokens from the lexer as it needs them, so a script is
+// parsed while it is read. There is no channel of tokens to go with it: the
+// parser counts the lexer's errors as it goes, which it could not do while
+// another goroutine was scanning.
+func NewReader(filename string, src io.Reader) *Lexer {
+	lex := &Lexer{src: src, buf: make([]byte, 0, bufSize), filename: filename, line: 1}
 	lex.readChar()
 	return lex
 }
 
+// fill makes sure at least n bytes from readPosition on are buffered unless
+// the input ends first. Bytes before mark are dropped to make room.
+func (l *Lexer) fill(n int) {
+	for !l.eof && l.readPosition+n > l.base+len(l.buf) {
+		if keep := l.mark - l.base; keep > 0 {
+			l.buf = l.buf[:copy(l.buf, l.buf[keep:])]
+			l.base = l.mark
+		}
+
+		if len(l.buf) == cap(l.buf) {
+			// the current token fills the whole buffer
+			buf := make([]byte, len(l.buf), 2*cap(l.buf))
+			copy(buf, l.buf)
+			l.buf = buf
+		}
+
+		m, err := l.src.Read(l.buf[len(l.buf):cap(l.buf)])
+		l.buf = l.buf[:len(l.buf)+m]
+		if err == io.EOF {
+			l.eof = true
+		} else if err != nil {
+			l.eof = true
+			l.error(l.pos(), l.pos(), diagnostic.ReadError, "read error: %v", err)
+		}
+	}
+}
+
+// text returns the input from offset start, which must not be before mark,
+// up to the current character.
+func (l *Lexer) text(start int) string {
+	return string(l.buf[start-l.base : l.position-l.base])
+}
+
+// rest returns the buffered input from offset on.
+func (l *Lexer) rest(offset int) []byte {
+	if offset-l.base >= len(l.buf) {
+		return nil
+	}
+
+	return l.buf[offset-l.base:]
+}
+
+// SetMode changes the mode of the lexer for the tokens read after the call.
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	l.fill(utf8.UTFMax)
+	if l.eof && l.readPosition > l.base+len(l.buf) {
+		// already at EOF, keep its position stable
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.column++
 	}
 
 	l.position = l.readPosition
-	l.readPosition++
+	next := l.rest(l.readPosition)
+	if len(next) == 0 {
+		l.ch = 0
+		l.readPosition++
+		return
+	}
+
+	r, width := utf8.DecodeRune(next)
+	if r == utf8.RuneError && width == 1 {
+		pos := l.pos()
+		end := pos
+		end.Offset++
+		end.Column++
+		l.error(pos, end, diagnostic.InvalidUTF8, "invalid UTF-8 encoding")
+	}
+
+	l.ch = r
+	l.readPosition += width
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// pos returns the position of the current character.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+func (l *Lexer) peekChar() rune {
+	l.fill(utf8.UTFMax)
+	next := l.rest(l.readPosition)
+	if len(next) == 0 {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+
+	r, _ := utf8.DecodeRune(next)
+	return r
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
 	l.skipWhiteSpaces()
+	l.mark = l.position
 
+	pos := l.pos()
+	tok := l.scanToken()
+	tok.Pos = pos
+	if tok.Type == token.EOF {
+		tok.End = pos
+	} else {
+		tok.End = l.pos()
+	}
+
+	return tok
+}
+
+func (l *Lexer) scanToken() token.Token {
+	var tok token.Token
 	switch l.ch {
 	case '+':
-		tok = token.Token{token.PLUS, string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
+		}
 	case '-':
-		tok = token.Token{token.MINUS, string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		}
 	case '*':
-		tok = token.Token{token.ASTERISK, string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
+		}
 	case '/':
-		tok = token.Token{token.SLASH, string(l.ch)}
+		if l.atComment() {
+			return token.Token{Type: token.Comment, Literal: l.readComment(true)}
+		}
+
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.SLASH, Literal: string(l.ch)}
+		}
 	case '=':
 		if l.peekChar() == '=' {
-			tok = token.Token{token.EQ, "=="}
+			tok = token.Token{Type: token.EQ, Literal: "=="}
 			l.readChar()
 		} else {
-			tok = token.Token{token.ASSIGN, string(l.ch)}
+			tok = token.Token{Type: token.ASSIGN, Literal: string(l.ch)}
 		}
 	case '(':
-		tok = token.Token{token.LPAREN, string(l.ch)}
+		tok = token.Token{Type: token.LPAREN, Literal: string(l.ch)}
 	case ')':
-		tok = token.Token{token.RPAREN, string(l.ch)}
+		tok = token.Token{Type: token.RPAREN, Literal: string(l.ch)}
+	case '[':
+		tok = token.NewToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = token.NewToken(token.RBRACKET, l.ch)
+	case ':':
+		tok = token.NewToken(token.COLON, l.ch)
 	case '{':
-		tok = token.Token{token.LBRACE, string(l.ch)}
+		if n := len(l.interp); n > 0 {
+			l.interp[n-1]++
+		}
+
+		tok = token.Token{Type: token.LBRACE, Literal: string(l.ch)}
 	case '}':
+		if n := len(l.interp); n > 0 {
+			if l.interp[n-1] == 0 {
+				// closes the interpolation, the string goes on
+				l.interp = l.interp[:n-1]
+				return l.readString(token.StringMid, token.StringTail)
+			}
+
+			l.interp[n-1]--
+		}
+
 		tok = token.NewToken(token.RBRACE, l.ch)
 	case ';':
 		tok = token.NewToken(token.SEMICOLON, l.ch)
+	case ',':
+		tok = token.NewToken(token.COMMA, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
-			tok = token.Token{token.NOT_EQ, "!="}
+			tok = token.Token{Type: token.NOT_EQ, Literal: "!="}
 			l.readChar()
 		} else {
-			tok = token.Token{token.BANG, string(l.ch)}
+			tok = token.Token{Type: token.BANG, Literal: string(l.ch)}
 		}
 	case '>':
 		if l.peekChar() == '=' {
-			tok = token.Token{token.GE, l.input[l.position : l.readPosition+1]}
+			tok = token.Token{Type: token.GE, Literal: ">="}
 			l.readChar()
 		} else {
-			tok = token.Token{token.GT, string(l.ch)}
+			tok = token.Token{Type: token.GT, Literal: string(l.ch)}
 		}
 	case '<':
 		if l.peekChar() == '=' {
-			tok = token.Token{token.LE, l.input[l.position : l.readPosition+1]}
+			tok = token.Token{Type: token.LE, Literal: "<="}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.LT, Literal: string(l.ch)}
+		}
+
+	case '&':
+		if l.peekChar() == '&' {
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+			l.readChar()
+		} else {
+			tok = l.illegal()
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = token.Token{Type: token.OR, Literal: "||"}
 			l.readChar()
 		} else {
-			tok = token.Token{token.LT, string(l.ch)}
+			tok = l.illegal()
 		}
 
 	case '"':
-		return l.readString()
+		return l.readString(token.StringHead, token.String)
 	case 0:
 		tok = token.Token{Type: token.EOF}
 	default:
@@ -99,12 +309,9 @@ func (l *Lexer) NextToken() token.Token {
 			}
 			return tok
 		} else if l.isNumber(l.ch) {
-			tok.Type = token.Integer
-			tok.Literal = l.readNum()
-			return tok
+			return l.readNum()
 		} else {
-			tok.Type = token.INVALID
-			tok.Literal = string(l.ch)
+			tok = l.illegal()
 		}
 	}
 
@@ -112,48 +319,295 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func (l *Lexer) isLetter(ch byte) bool {
-	return ch >= 'a' && ch <= 'z' || ch > +'A' && ch <= 'Z' || ch == '_'
+// illegal returns an INVALID token for the current character and reports it,
+// unless it is an invalid UTF-8 byte that readChar reported already.
+func (l *Lexer) illegal() token.Token {
+	literal := string(l.ch)
+	if cur := l.rest(l.position); l.ch == utf8.RuneError && !bytes.HasPrefix(cur, []byte(literal)) {
+		return token.Token{Type: token.INVALID, Literal: string(cur[:1])}
+	}
+
+	end := l.pos()
+	end.Offset += len(literal)
+	end.Column++
+	l.error(l.pos(), end, diagnostic.IllegalCharacter, "illegal character %q", l.ch)
+	return token.Token{Type: token.INVALID, Literal: literal}
 }
 
-func (l *Lexer) readString() token.Token {
-	position := l.position
+// isLetter reports whether ch may start an identifier.
+func (l *Lexer) isLetter(ch rune) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// readString reads string content up to the closing quote or the next ${.
+// The current character is the opening quote or the } that closed the
+// previous interpolation. The token is of type open when the string stops at
+// ${ and of type closed when it stops at the quote; its literal holds the
+// content with escape sequences resolved.
+func (l *Lexer) readString(open, closed token.TokenType) token.Token {
+	start := l.pos()
+	var out strings.Builder
+	l.readChar()
+	for {
+		// the content is collected in out, the raw input is not needed
+		l.mark = l.position
+		switch l.ch {
+		case '"':
+			l.readChar()
+			return token.Token{Type: closed, Literal: out.String()}
+		case 0:
+			l.error(start, l.pos(), diagnostic.UnterminatedString, "string literal not terminated")
+			return token.Token{Type: closed, Literal: out.String()}
+		case '\\':
+			l.readEscape(&out)
+		case '$':
+			if l.peekChar() == '{' {
+				l.readChar()
+				l.readChar()
+				l.interp = append(l.interp, 0)
+				return token.Token{Type: open, Literal: out.String()}
+			}
+
+			out.WriteRune(l.ch)
+			l.readChar()
+		default:
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+}
+
+// readEscape resolves the escape sequence starting at the current backslash
+// and writes the result to out.
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.pos()
 	l.readChar()
-	for l.ch != '"' && l.ch != 0 {
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"', '\\', '$':
+		out.WriteRune(l.ch)
+	case 'u':
+		l.readUnicodeEscape(out, start)
+		return
+	case 0:
+		// reported as unterminated string by the caller
+		return
+	default:
+		ch := l.ch
 		l.readChar()
+		l.error(start, l.pos(), diagnostic.InvalidEscape, "unknown escape sequence \\%c", ch)
+		return
+	}
+
+	l.readChar()
+}
+
+// readUnicodeEscape reads the {XXXX} part of a \u{XXXX} escape.
+func (l *Lexer) readUnicodeEscape(out *strings.Builder, start token.Position) {
+	l.readChar()
+	if l.ch != '{' {
+		l.error(start, l.pos(), diagnostic.InvalidEscape, "expected { after \\u")
+		return
 	}
 
-	if l.ch == '"' {
+	l.readChar()
+	var r rune
+	digits := 0
+	for l.isHexDigit(l.ch) {
+		r = r*16 + rune(hexValue(l.ch))
+		digits++
 		l.readChar()
 	}
 
-	if l.ch == 0 {
-		return token.Token{Type: token.INVALID, Literal: l.input[position:]}
+	if l.ch != '}' {
+		l.error(start, l.pos(), diagnostic.InvalidEscape, "expected hex digits and } in \\u{...}")
+		return
 	}
 
-	return token.Token{Type: token.String, Literal: l.input[position:l.position]}
+	l.readChar()
+	if digits == 0 || digits > 6 || !utf8.ValidRune(r) {
+		l.error(start, l.pos(), diagnostic.InvalidEscape, "invalid unicode code point in escape sequence")
+		return
+	}
+
+	out.WriteRune(r)
+}
+
+func (l *Lexer) isHexDigit(ch rune) bool {
+	return l.isNumber(ch) || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+func hexValue(ch rune) int {
+	switch {
+	case ch >= 'a':
+		return int(ch-'a') + 10
+	case ch >= 'A':
+		return int(ch-'A') + 10
+	default:
+		return int(ch - '0')
+	}
+}
+
+// Errors returns the problems found in the input so far.
+func (l *Lexer) Errors() diagnostic.ErrorList {
+	return l.errors
+}
+
+func (l *Lexer) error(pos, end token.Position, code diagnostic.Code, format string, a ...interface{}) {
+	l.errors.Add(&diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      pos,
+		End:      end,
+	})
 }
 
 func (l *Lexer) readIdentify() string {
 	position := l.position
-	for l.isLetter(l.ch) {
+	for l.isLetter(l.ch) || l.isDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	return l.text(position)
 }
 
-func (l *Lexer) isNumber(ch byte) bool {
+func (l *Lexer) isNumber(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-func (l *Lexer) readNum() string {
+// isDigit reports whether ch may continue an identifier as a digit.
+func (l *Lexer) isDigit(ch rune) bool {
+	return l.isNumber(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
+}
+
+// readNum reads an integer such as 42, 1_000, 0x1F, 0o17 or 0b1010, or a
+// float such as 3.14, 1e-9 or 2.5E+3. Malformed numbers are reported and
+// returned as INVALID.
+func (l *Lexer) readNum() token.Token {
 	position := l.position
-	for l.isNumber(l.ch) {
+	start := l.pos()
+	tok := token.Token{Type: token.Integer}
+
+	base := 10
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	if base != 10 {
+		l.readChar()
+		l.readChar()
+		l.readDigits(base)
+	} else {
+		l.readDigits(base)
+		if l.ch == '.' && l.isNumber(l.peekChar()) {
+			tok.Type = token.Float
+			l.readChar()
+			l.readDigits(base)
+		}
+
+		if l.ch == 'e' || l.ch == 'E' {
+			tok.Type = token.Float
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+
+			l.readDigits(base)
+		}
+	}
+
+	// swallow letters glued to the number so 12abc is one bad token
+	for l.isLetter(l.ch) || l.isDigit(l.ch) {
+		l.readChar()
+	}
+
+	tok.Literal = l.text(position)
+	if msg := checkNumber(tok.Literal, base); msg != "" {
+		l.error(start, l.pos(), diagnostic.InvalidNumber, "invalid number %s: %s", tok.Literal, msg)
+		tok.Type = token.INVALID
+	}
+
+	return tok
+}
+
+// readDigits reads digits and underscores. Below base 10 it reads all
+// decimal digits, checkNumber reports the ones out of range.
+func (l *Lexer) readDigits(base int) {
+	for l.isNumber(l.ch) || l.ch == '_' || base == 16 && l.isHexDigit(l.ch) {
 		l.readChar()
 	}
+}
+
+// checkNumber returns why lit is not a valid number literal of base, or ""
+// if it is fine.
+func checkNumber(lit string, base int) string {
+	digits := lit
+	if base != 10 {
+		digits = lit[2:]
+		if strings.HasPrefix(digits, "_") {
+			// 0x_1F separates the prefix from the digits
+			digits = digits[1:]
+		}
+	}
+
+	parts := []string{digits}
+	if base == 10 {
+		mantissa, exponent := digits, ""
+		if i := strings.IndexAny(digits, "eE"); i >= 0 {
+			mantissa, exponent = digits[:i], strings.TrimLeft(digits[i+1:], "+-")
+			if exponent == "" {
+				return "exponent has no digits"
+			}
+		}
+
+		parts = strings.Split(mantissa, ".")
+		if exponent != "" {
+			parts = append(parts, exponent)
+		}
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return "missing digits"
+		}
+
+		if part[0] == '_' || part[len(part)-1] == '_' || strings.Contains(part, "__") {
+			return "'_' must separate successive digits"
+		}
+
+		for _, ch := range part {
+			if ch != '_' && !isDigitOfBase(ch, base) {
+				return fmt.Sprintf("invalid digit %q in base %d literal", ch, base)
+			}
+		}
+	}
+
+	return ""
+}
 
-	return l.input[position:l.position]
+func isDigitOfBase(ch rune, base int) bool {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch-'0') < base
+	case ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F':
+		return base == 16
+	default:
+		return false
+	}
 }
 
 func (l *Lexer) Tokens() []token.Token {
@@ -167,8 +621,75 @@ func (l *Lexer) Tokens() []token.Token {
 	return tokens
 }
 
+// skipWhiteSpaces skips white space and, unless the lexer scans comments,
+// comments as well.
 func (l *Lexer) skipWhiteSpaces() {
-	for l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r' {
+	for {
+		l.mark = l.position
+		switch {
+		case l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r':
+			l.readChar()
+		case l.mode&ScanComments == 0 && l.atComment():
+			l.readComment(false)
+		default:
+			return
+		}
+	}
+}
+
+// atComment reports whether a // or /* comment starts at the current character.
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads a // line comment up to the end of the line or a /* */
+// block comment, which may nest, and returns its text with the delimiters.
+// Unless keep is set the text is dropped from the buffer as it is read, so
+// a long comment need not fit in memory, and "" is returned.
+func (l *Lexer) readComment(keep bool) string {
+	position, start := l.position, l.pos()
+	text := func() string {
+		if !keep {
+			return ""
+		}
+
+		return l.text(position)
+	}
+	next := func() {
 		l.readChar()
+		if !keep {
+			l.mark = l.position
+		}
+	}
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			next()
+		}
+
+		return strings.TrimRight(text(), "\r")
 	}
+
+	next()
+	next()
+	for depth := 1; depth > 0; {
+		switch {
+		case l.ch == 0:
+			end := start
+			end.Offset += 2
+			end.Column += 2
+			l.error(start, end, diagnostic.UnterminatedComment, "comment not terminated")
+			return text()
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			next()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			next()
+		}
+
+		next()
+	}
+
+	return text()
 }
@@ -1,8 +1,14 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
+	"github.com/abusizhishen/zlang/diagnostic"
+	"github.com/abusizhishen/zlang/token"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestLexer_Tokens(t *testing.T) {
@@ -18,3 +24,464 @@ func TestLexer_Tokens(t *testing.T) {
 		fmt.Println(tok)
 	}
 }
+
+func TestLexer_Positions(t *testing.T) {
+	input := "let a = 10;\n  a >= 5"
+
+	tests := []struct {
+		literal string
+		pos     token.Position
+		end     token.Position
+	}{
+		{"let", token.Position{Filename: "a.zl", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "a.zl", Offset: 3, Line: 1, Column: 4}},
+		{"a", token.Position{Filename: "a.zl", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "a.zl", Offset: 5, Line: 1, Column: 6}},
+		{"=", token.Position{Filename: "a.zl", Offset: 6, Line: 1, Column: 7}, token.Position{Filename: "a.zl", Offset: 7, Line: 1, Column: 8}},
+		{"10", token.Position{Filename: "a.zl", Offset: 8, Line: 1, Column: 9}, token.Position{Filename: "a.zl", Offset: 10, Line: 1, Column: 11}},
+		{";", token.Position{Filename: "a.zl", Offset: 10, Line: 1, Column: 11}, token.Position{Filename: "a.zl", Offset: 11, Line: 1, Column: 12}},
+		{"a", token.Position{Filename: "a.zl", Offset: 14, Line: 2, Column: 3}, token.Position{Filename: "a.zl", Offset: 15, Line: 2, Column: 4}},
+		{">=", token.Position{Filename: "a.zl", Offset: 16, Line: 2, Column: 5}, token.Position{Filename: "a.zl", Offset: 18, Line: 2, Column: 7}},
+		{"5", token.Position{Filename: "a.zl", Offset: 19, Line: 2, Column: 8}, token.Position{Filename: "a.zl", Offset: 20, Line: 2, Column: 9}},
+		{"", token.Position{Filename: "a.zl", Offset: 20, Line: 2, Column: 9}, token.Position{Filename: "a.zl", Offset: 20, Line: 2, Column: 9}},
+	}
+
+	l := NewFile("a.zl", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+
+		if tok.Pos != tt.pos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.pos, tok.Pos)
+		}
+
+		if tok.End != tt.end {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.end, tok.End)
+		}
+	}
+}
+
+func TestLexer_NextToken(t *testing.T) {
+	input := `let add = fun(x, y) { x + y; };
+add(1, 2)`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.Let, "let"},
+		{token.Identifier, "add"},
+		{token.ASSIGN, "="},
+		{token.FUN, "fun"},
+		{token.LPAREN, "("},
+		{token.Identifier, "x"},
+		{token.COMMA, ","},
+		{token.Identifier, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.Identifier, "x"},
+		{token.PLUS, "+"},
+		{token.Identifier, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.Identifier, "add"},
+		{token.LPAREN, "("},
+		{token.Integer, "1"},
+		{token.COMMA, ","},
+		{token.Integer, "2"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLexer_Strings(t *testing.T) {
+	input := `"hello" "a\tb\n" "say \"hi\" \\ \$x" "\u{4e2d}\u{1F600}" "hi ${name}!" "${a} and ${ {b} }" ""`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.String, "hello"},
+		{token.String, "a\tb\n"},
+		{token.String, `say "hi" \ $x`},
+		{token.String, "中😀"},
+		{token.StringHead, "hi "},
+		{token.Identifier, "name"},
+		{token.StringTail, "!"},
+		{token.StringHead, ""},
+		{token.Identifier, "a"},
+		{token.StringMid, " and "},
+		{token.LBRACE, "{"},
+		{token.Identifier, "b"},
+		{token.RBRACE, "}"},
+		{token.StringTail, ""},
+		{token.String, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestLexer_StringErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+		pos   string
+	}{
+		{`"abc`, diagnostic.UnterminatedString, "1:1"},
+		{`"a\qb"`, diagnostic.InvalidEscape, "1:3"},
+		{`"\u{110000}"`, diagnostic.InvalidEscape, "1:2"},
+		{`"\u{}"`, diagnostic.InvalidEscape, "1:2"},
+		{`"\u12"`, diagnostic.InvalidEscape, "1:2"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.Tokens()
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error, got %d. input:%q", len(errors), tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code || errors[0].Pos.String() != tt.pos {
+			t.Errorf("error wrong. expected=%s at %s, got=%s at %s input:%q", tt.code, tt.pos, errors[0].Code, errors[0].Pos, tt.input)
+		}
+	}
+}
+
+func TestLexer_Unicode(t *testing.T) {
+	input := "let 名字 = \"张三\"\nlet café2 = 名字 + \"é\" @"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		pos             token.Position
+	}{
+		{token.Let, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.Identifier, "名字", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 11, Line: 1, Column: 8}},
+		{token.String, "张三", token.Position{Offset: 13, Line: 1, Column: 10}},
+		{token.Let, "let", token.Position{Offset: 22, Line: 2, Column: 1}},
+		{token.Identifier, "café2", token.Position{Offset: 26, Line: 2, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 33, Line: 2, Column: 11}},
+		{token.Identifier, "名字", token.Position{Offset: 35, Line: 2, Column: 13}},
+		{token.PLUS, "+", token.Position{Offset: 42, Line: 2, Column: 16}},
+		{token.String, "é", token.Position{Offset: 44, Line: 2, Column: 18}},
+		{token.INVALID, "@", token.Position{Offset: 49, Line: 2, Column: 22}},
+		{token.EOF, "", token.Position{Offset: 50, Line: 2, Column: 23}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.pos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.pos, tok.Pos)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Code != diagnostic.IllegalCharacter {
+		t.Errorf("expected one illegal character error, got %v", errors)
+	}
+}
+
+func TestLexer_InvalidUTF8(t *testing.T) {
+	input := "let a\xff = \"b\xfe\""
+
+	l := New(input)
+	tokens := l.Tokens()
+	if tokens[2].Type != token.INVALID {
+		t.Errorf("tokens[2] - type wrong. expected=%q, got=%q", token.INVALID, tokens[2].Type)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errors), errors)
+	}
+
+	for i, pos := range []string{"1:6", "1:12"} {
+		if errors[i].Code != diagnostic.InvalidUTF8 || errors[i].Pos.String() != pos {
+			t.Errorf("errors[%d] wrong. expected=%s at %s, got=%s at %s", i, diagnostic.InvalidUTF8, pos, errors[i].Code, errors[i].Pos)
+		}
+	}
+}
+
+func TestLexer_Numbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"1_000_000", token.Integer, "1_000_000"},
+		{"0x1F", token.Integer, "0x1F"},
+		{"0o17", token.Integer, "0o17"},
+		{"0b1010", token.Integer, "0b1010"},
+		{"0xdead_beef", token.Integer, "0xdead_beef"},
+		{"0x_1", token.Integer, "0x_1"},
+		{"017", token.Integer, "017"},
+		{"3.14", token.Float, "3.14"},
+		{"1e-9", token.Float, "1e-9"},
+		{"2.5E+10", token.Float, "2.5E+10"},
+		{"1_0.0_1", token.Float, "1_0.0_1"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("token wrong. expected=%s %q, got=%s %q", tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("expected EOF after %q, got=%s %q", tt.input, next.Type, next.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, l.Errors())
+		}
+	}
+}
+
+func TestLexer_NumberErrors(t *testing.T) {
+	tests := []string{"0x", "1__0", "1_", "0b102", "0o8", "12abc", "1e", "1.5e+"}
+
+	for _, input := range tests {
+		l := New(input)
+		tok := l.NextToken()
+		if tok.Type != token.INVALID || tok.Literal != input {
+			t.Errorf("expected INVALID %q, got=%s %q", input, tok.Type, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 || errors[0].Code != diagnostic.InvalidNumber || errors[0].Pos.String() != "1:1" {
+			t.Errorf("expected one invalid number error at 1:1 for %q, got %v", input, errors)
+		}
+	}
+}
+
+func TestLexer_Comments(t *testing.T) {
+	input := "let a = 1 // one\n/* block /* nested */ still */ a / 2 /**/"
+
+	skipped := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.Let, "let"},
+		{token.Identifier, "a"},
+		{token.ASSIGN, "="},
+		{token.Integer, "1"},
+		{token.Identifier, "a"},
+		{token.SLASH, "/"},
+		{token.Integer, "2"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range skipped {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("skipped[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	scanned := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		pos             string
+	}{
+		{token.Let, "let", "1:1"},
+		{token.Identifier, "a", "1:5"},
+		{token.ASSIGN, "=", "1:7"},
+		{token.Integer, "1", "1:9"},
+		{token.Comment, "// one", "1:11"},
+		{token.Comment, "/* block /* nested */ still */", "2:1"},
+		{token.Identifier, "a", "2:32"},
+		{token.SLASH, "/", "2:34"},
+		{token.Integer, "2", "2:36"},
+		{token.Comment, "/**/", "2:38"},
+		{token.EOF, "", "2:42"},
+	}
+
+	l = New(input)
+	l.SetMode(ScanComments)
+	for i, tt := range scanned {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("scanned[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.String() != tt.pos {
+			t.Errorf("scanned[%d] - pos wrong. expected=%s, got=%s", i, tt.pos, tok.Pos)
+		}
+	}
+}
+
+func TestLexer_UnterminatedComment(t *testing.T) {
+	for _, input := range []string{"1 /* open", "1 /* a /* b */"} {
+		l := New(input)
+		toks := l.Tokens()
+		if len(toks) != 1 || toks[0].Type != token.Integer {
+			t.Errorf("expected a single INTEGER, got %v input:%q", toks, input)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 || errors[0].Code != diagnostic.UnterminatedComment || errors[0].Pos.String() != "1:3" {
+			t.Errorf("expected one unterminated comment error at 1:3, got %v input:%q", errors, input)
+		}
+	}
+}
+
+// streamInput returns a script that exercises every kind of token and is a
+// few times larger than the reader buffer, with a string and an identifier
+// that do not fit in it.
+func streamInput() string {
+	var out strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&out, "let a%d = 0x%x + 1_0.5e-1 // line %d\n", i, i, i)
+		out.WriteString("/* block /* nested */ */ if a >= 名字 && b != \"s ${x} \\u{4e16}\" { return fun(x, y) { x * y } }\n")
+	}
+
+	fmt.Fprintf(&out, "let long = \"%s\"\n", strings.Repeat("字", 3*bufSize))
+	// skipped comments are dropped as they are read, however long
+	fmt.Fprintf(&out, "/* %s /* %[1]s */ */ // %[1]s\n", strings.Repeat("c", 16*bufSize))
+	fmt.Fprintf(&out, "let %s = 1 @ \"unterminated", strings.Repeat("x", 2*bufSize))
+	return out.String()
+}
+
+func TestLexer_NewReader(t *testing.T) {
+	input := streamInput()
+
+	readers := map[string]io.Reader{
+		"reader":   strings.NewReader(input),
+		"one byte": iotest.OneByteReader(strings.NewReader(input)),
+		"half":     iotest.HalfReader(strings.NewReader(input)),
+	}
+
+	for name, r := range readers {
+		want := NewFile("a.zl", input)
+		got := NewReader("a.zl", r)
+		for i := 0; ; i++ {
+			expected, actual := want.NextToken(), got.NextToken()
+			if expected != actual {
+				t.Fatalf("%s: tokens[%d] wrong. expected=%+v, got=%+v", name, i, expected, actual)
+			}
+
+			if expected.Type == token.EOF {
+				break
+			}
+		}
+
+		if fmt.Sprint(want.Errors()) != fmt.Sprint(got.Errors()) {
+			t.Errorf("%s: errors wrong. expected=%v, got=%v", name, want.Errors(), got.Errors())
+		}
+
+		if cap(got.buf) > 8*bufSize {
+			t.Errorf("%s: buffer grew to %d bytes", name, cap(got.buf))
+		}
+	}
+}
+
+func TestLexer_ReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("let a = 1"), iotest.ErrReader(errors.New("disk on fire")))
+	l := NewReader("", r)
+
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+
+	if len(types) != 4 || types[3] != token.Integer {
+		t.Errorf("tokens before the error wrong. got=%v", types)
+	}
+
+	errs := l.Errors()
+	if len(errs) != 1 || errs[0].Code != diagnostic.ReadError || errs[0].Message != "read error: disk on fire" {
+		t.Errorf("expected one read error, got %v", errs)
+	}
+}
+
+func benchmarkInput() string {
+	var out strings.Builder
+	for out.Len() < 1<<20 {
+		out.WriteString("let add = fun(a, b) { a + b } // add two numbers\n")
+		out.WriteString("if add(1, 2.5) >= 3 { \"yes ${add(1, 2)}\" } else { return 0x1F }\n")
+	}
+
+	return out.String()
+}
+
+func BenchmarkLexer_String(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkLexer_Reader(b *testing.B) {
+	input := benchmarkInput()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := NewReader("", strings.NewReader(input))
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func TestLexer_AssignOperators(t *testing.T) {
+	input := "x += 1 -= 2 *= 3 /= 4 = 5 == 6 // c"
+	expected := []token.TokenType{
+		token.Identifier, token.PLUS_ASSIGN, token.Integer, token.MINUS_ASSIGN, token.Integer,
+		token.ASTERISK_ASSIGN, token.Integer, token.SLASH_ASSIGN, token.Integer,
+		token.ASSIGN, token.Integer, token.EQ, token.Integer, token.EOF,
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package object
+
+type Environment struct {
+	store  map[string]Object
+	consts map[string]bool // names of store bound by const
+	outer  *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object), consts: make(map[string]bool)}
+}
+
+// NewEnclosedEnvironment returns a new scope nested in outer. Names not
+// found in the new scope are looked up in outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// SetConst binds name like Set and marks the binding as constant.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+// IsConst reports whether name resolves to a constant binding.
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.consts[name]
+		}
+	}
+
+	return false
+}
+
+// IsLocalConst reports whether name is bound by const in this scope itself,
+// ignoring the outer scopes.
+func (e *Environment) IsLocalConst(name string) bool {
+	return e.consts[name]
+}
+
+// Assign rebinds name in the innermost scope that declares it. It reports
+// false, changing nothing, when no scope declares name.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,251 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/token"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      ObjectType = "INTEGER"
+	BOOLEAN_OBJ      ObjectType = "BOOLEAN"
+	NULL_OBJ         ObjectType = "NULL"
+	RETURN_VALUE_OBJ ObjectType = "RETURN_VALUE"
+	ERROR_OBJ        ObjectType = "ERROR"
+	FUNCTION_OBJ     ObjectType = "FUNCTION"
+	STRING_OBJ       ObjectType = "STRING"
+	FLOAT_OBJ        ObjectType = "FLOAT"
+	ARRAY_OBJ        ObjectType = "ARRAY"
+	HASH_OBJ         ObjectType = "HASH"
+	BREAK_OBJ        ObjectType = "BREAK"
+	CONTINUE_OBJ     ObjectType = "CONTINUE"
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect prints the shortest representation that reads back as the same
+// value, keeping a ".0" on integral values so they don't look like integers.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+
+	return s + ".0"
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := make([]string, 0, len(a.Elements))
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a value used as a hash key. Equal values have equal
+// keys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps hashable keys to values and remembers the order in which keys
+// were added. Different keys may share a HashKey, so the pairs are indexed
+// by it and the keys themselves compared on lookup.
+type Hash struct {
+	Pairs []HashPair // insertion order
+	index map[HashKey][]int
+}
+
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey][]int)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := make([]string, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Get returns the value stored under key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	if i, ok := h.find(key); ok {
+		return h.Pairs[i].Value, true
+	}
+
+	return nil, false
+}
+
+// Set stores value under key, keeping the position of a key that is
+// already present.
+func (h *Hash) Set(key Hashable, value Object) {
+	if i, ok := h.find(key); ok {
+		h.Pairs[i].Value = value
+		return
+	}
+
+	k := key.HashKey()
+	h.index[k] = append(h.index[k], len(h.Pairs))
+	h.Pairs = append(h.Pairs, HashPair{Key: key, Value: value})
+}
+
+// find returns the position of key in Pairs.
+func (h *Hash) find(key Hashable) (int, bool) {
+	for _, i := range h.index[key.HashKey()] {
+		if sameKey(h.Pairs[i].Key, key) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// sameKey reports whether a and b are the same key. Hashable values of
+// one type print differently whenever they differ.
+func sameKey(a, b Object) bool {
+	return a.Type() == b.Type() && a.Inspect() == b.Inspect()
+}
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// ReturnValue wraps the value of a return statement so that it can bubble
+// up through nested blocks until it reaches the program boundary.
+type ReturnValue struct {
+	Value Object
+}
+
+func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
+
+// Break and Continue are the results of break and continue statements. Like
+// ReturnValue they stop the enclosing blocks until they reach their loop.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+type Error struct {
+	Message string
+	Pos     token.Position // where the error was raised, if known
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+
+	return "ERROR: " + e.Message
+}
+
+// Function is a function value together with the environment it was
+// defined in, which makes it a closure.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+	params := make([]string, 0, len(f.Parameters))
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fun(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	for _, stmt := range f.Body.Statements {
+		out.WriteString(stmt.String())
+		out.WriteString("\n")
+	}
+
+	out.WriteString("}")
+	return out.String()
+}
@@ -0,0 +1,49 @@
+package object
+
+import "testing"
+
+// collider is a string whose HashKey is the same for every value.
+type collider struct {
+	String
+}
+
+func (c *collider) HashKey() HashKey {
+	return HashKey{Type: c.Type(), Value: 0}
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	hash := NewHash()
+	a := &collider{String{Value: "a"}}
+	b := &collider{String{Value: "b"}}
+
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(a, &Integer{Value: 3})
+
+	tests := []struct {
+		key      Hashable
+		expected string
+	}{
+		{a, "3"},
+		{b, "2"},
+	}
+
+	for _, tt := range tests {
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Errorf("no pair for key %s", tt.key.Inspect())
+			continue
+		}
+		if value.Inspect() != tt.expected {
+			t.Errorf("value for key %s wrong. expected=%s, got=%s", tt.key.Inspect(), tt.expected, value.Inspect())
+		}
+	}
+
+	if _, ok := hash.Get(&collider{String{Value: "c"}}); ok {
+		t.Errorf("found a pair for a key that was never set")
+	}
+
+	if hash.Inspect() != "{a: 3, b: 2}" {
+		t.Errorf("Inspect() wrong. got=%q", hash.Inspect())
+	}
+}
@@ -1,28 +1,43 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/diagnostic"
 	"github.com/abusizhishen/zlang/lexer"
 	"github.com/abusizhishen/zlang/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = OR += OR -= OR *= OR /=
+	OR          // ||
+	AND         // &&
 	EQUALS      //==
-	LESSGREATER // > OR <
+	LESSGREATER // > OR < OR <= OR >=
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X OR !X
 	CALL        //myFunction(x)
+	INDEX       // array[index]
 )
 
+// DefaultMaxErrors is the number of errors after which a parser stops.
+const DefaultMaxErrors = 10
+
 type Parser struct {
 	curToken, peekToken token.Token
 	l                   *lexer.Lexer
-	errors              []string
+	errors              diagnostic.ErrorList
+	exprLev             int // > 0 inside parentheses
+	loopDepth           int // > 0 inside the body of a loop
+	blockDepth          int // > 0 inside a block
+	maxErrors           int // stop after that many errors, no limit if <= 0
+	comments            []*ast.Comment
 	prefixParseFns      map[token.TokenType]prefixParseFns
 	infixParseFns       map[token.TokenType]infixParseFns
 }
@@ -32,13 +47,20 @@ type (
 	infixParseFns  func(expression ast.Expression) ast.Expression
 )
 
+// nextToken advances to the next token. Comments, which the lexer only
+// returns in ScanComments mode, are collected aside and never reach the
+// grammar.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.Comment {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l}
+	p := &Parser{l: l, maxErrors: DefaultMaxErrors}
 
 	p.nextToken()
 	p.nextToken()
@@ -47,12 +69,19 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefixParseFns(token.Identifier, p.parseIdentifier)
 	p.registerPrefixParseFns(token.Integer, p.parseIntegerLiteral)
+	p.registerPrefixParseFns(token.Float, p.parseFloatLiteral)
+	p.registerPrefixParseFns(token.String, p.parseStringLiteral)
+	p.registerPrefixParseFns(token.StringHead, p.parseInterpolatedString)
 	p.registerPrefixParseFns(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParseFns(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefixParseFns(token.True, p.parseBoolLiteral)
 	p.registerPrefixParseFns(token.False, p.parseBoolLiteral)
 	p.registerPrefixParseFns(token.LPAREN, p.parseGroupedExpress)
 	p.registerPrefixParseFns(token.IF, p.parseIfExpress)
+	p.registerPrefixParseFns(token.FUN, p.parseFunctionLiteral)
+	p.registerPrefixParseFns(token.Switch, p.parseSwitchExpression)
+	p.registerPrefixParseFns(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefixParseFns(token.LBRACE, p.parseHashLiteral)
 
 	p.registerInfixParseFns(token.PLUS, p.parseInfixExpression)
 	p.registerInfixParseFns(token.MINUS, p.parseInfixExpression)
@@ -62,43 +91,186 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixParseFns(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfixParseFns(token.LT, p.parseInfixExpression)
 	p.registerInfixParseFns(token.GT, p.parseInfixExpression)
+	p.registerInfixParseFns(token.LE, p.parseInfixExpression)
+	p.registerInfixParseFns(token.GE, p.parseInfixExpression)
+	p.registerInfixParseFns(token.AND, p.parseInfixExpression)
+	p.registerInfixParseFns(token.OR, p.parseInfixExpression)
+	p.registerInfixParseFns(token.LPAREN, p.parseCallExpression)
+	p.registerInfixParseFns(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixParseFns(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfixParseFns(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParseFns(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParseFns(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParseFns(token.SLASH_ASSIGN, p.parseAssignExpression)
 	return p
 }
 
+// SetMaxErrors sets the number of errors after which the parser gives up,
+// DefaultMaxErrors unless changed. n <= 0 removes the limit.
+func (p *Parser) SetMaxErrors(n int) {
+	p.maxErrors = n
+}
+
+// ParseProgram parses the whole input. It only checks the syntax: semantic
+// errors such as assigning to a constant are left to the checker package.
 func (p *Parser) ParseProgram() *ast.Program {
 	var program = &ast.Program{}
-	for p.curToken.Type != token.EOF {
-		stmt := p.ParseStatement()
+	for p.curToken.Type != token.EOF && !p.tooManyErrors() {
+		if p.curTokenIs(token.SEMICOLON) {
+			// an empty statement
+			p.nextToken()
+			continue
+		}
+
+		stmt := p.parseStatementRecover()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
 	return program
 }
 
-func (p *Parser) nextStatement() ast.Statement {
-	return nil
+// parseStatementRecover parses a statement and, when that fails, skips to
+// the next synchronization point so one mistake yields one error instead of
+// a cascade. A statement that could not be parsed at all is replaced with an
+// *ast.BadStatement covering the skipped source.
+func (p *Parser) parseStatementRecover() ast.Statement {
+	start, errs := p.curToken, len(p.errors)+len(p.l.Errors())
+	stmt := p.ParseStatement()
+	if stmt != nil && len(p.errors)+len(p.l.Errors()) == errs {
+		return stmt
+	}
+
+	p.sync()
+	if stmt == nil {
+		stmt = &ast.BadStatement{From: start.Pos, To: p.curToken.End}
+	}
+
+	return stmt
+}
+
+// sync advances to the last token before the next statement: a semicolon,
+// the end of the line, the } closing the enclosing block or a token right
+// before a statement keyword. Brackets opened while skipping are skipped as
+// a whole, a } at the top level is skipped like any other token.
+func (p *Parser) sync() {
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			if depth > 0 {
+				depth--
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.EOF, token.Let, token.Const, token.Return, token.IF, token.Switch, token.FUN,
+				token.While, token.For, token.Break, token.Continue:
+				return
+			case token.RBRACE:
+				if p.blockDepth > 0 {
+					return
+				}
+			}
+
+			if p.peekToken.Pos.Line > p.curToken.End.Line {
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+func (p *Parser) tooManyErrors() bool {
+	return p.maxErrors > 0 && len(p.errors)+len(p.l.Errors()) > p.maxErrors
 }
 
 func (p *Parser) ParseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.Let:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
+	case token.Const:
+		if stmt := p.parseConstStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
 	case token.Return:
-		return p.parseReturnStatement()
-	case token.IF:
-		return p.parseIfStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
+	case token.While:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
+	case token.For:
+		return p.parseForStatement()
+	case token.Break, token.Continue:
+		if stmt := p.parseBranchStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
 	default:
-		return p.parseExpressionStatement()
+		if stmt := p.parseExpressionStatement(); stmt != nil {
+			return stmt
+		}
+
+		return nil
 	}
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
+	stmt := p.parseLetBinding()
+	if stmt == nil {
+		return nil
+	}
+
+	if !isBad(stmt.Value) {
+		p.expectStatementEnd()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	binding := p.parseLetBinding()
+	if binding == nil {
+		return nil
+	}
+
+	if !isBad(binding.Value) {
+		p.expectStatementEnd()
+	}
+
+	return &ast.ConstStatement{Token: binding.Token, Name: binding.Name, Value: binding.Value}
+}
+
+// parseLetBinding parses let name = value without what ends the statement,
+// so it can also be used in the header of a for loop.
+func (p *Parser) parseLetBinding() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 	if p.peekToken.Type != token.Identifier {
-		p.peekError(token.Identifier, p.curToken.Type)
+		p.peekError(token.Identifier)
 		return nil
 	}
 
@@ -109,25 +281,123 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	if !p.peekTokenIs(token.ASSIGN) {
-		p.peekError(token.ASSIGN, p.peekToken.Type)
+		p.peekError(token.ASSIGN)
 		return nil
 	}
 
 	p.nextToken()
-	//p.nextToken()
-
-	if p.peekTokenIs(token.IF) {
-		p.nextToken()
-		stmt.Value = p.parseIfExpress()
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		p.missingExpressionError(stmt.Token.Literal + " " + stmt.Name.Value + " =")
+		stmt.Value = &ast.BadExpression{From: p.curToken.End, To: p.curToken.End}
 		return stmt
 	}
 
-	//todo express handle until meet semi
-	for p.curToken.Type != token.SEMICOLON && p.curToken.Type != token.EOF {
+	p.nextToken()
+	stmt.Value = p.parseExpressionOrBad(LOWEST)
+	return stmt
+}
+
+// parseExpressionOrBad parses an expression, returning an
+// *ast.BadExpression in place of one that could not be parsed. The bad
+// expression always comes with a diagnostic, reported at its position if
+// parsing failed without one.
+func (p *Parser) parseExpressionOrBad(precedence int) ast.Expression {
+	start, errs := p.curToken, len(p.errors)
+	if exp := p.parseExpression(precedence); exp != nil {
+		return exp
+	}
+
+	// an INVALID token was reported by the lexer
+	if len(p.errors) == errs && start.Type != token.INVALID {
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.MissingExpression,
+			Message:  fmt.Sprintf("expected expression, got: %s", start.Type),
+			Pos:      start.Pos,
+			End:      start.End,
+			Found:    start.Type,
+		})
+	}
+
+	return &ast.BadExpression{From: start.Pos, To: p.curToken.End}
+}
+
+// isBad reports whether exp is or contains an *ast.BadExpression, whose
+// error was reported already.
+func isBad(exp ast.Expression) bool {
+	bad := false
+	ast.Inspect(exp, func(n ast.Node) bool {
+		if _, ok := n.(*ast.BadExpression); ok {
+			bad = true
+		}
+
+		return !bad
+	})
+
+	return bad
+}
+
+// missingOperand reports an operand missing after the operator that is the
+// current token when the next token starts a statement instead, such as the
+// let after a + dangling at the end of a line.
+func (p *Parser) missingOperand() bool {
+	switch p.peekToken.Type {
+	case token.Let, token.Const, token.Return, token.While, token.For:
+		p.missingExpressionError(p.curToken.Literal)
+		return true
+	}
+
+	return false
+}
+
+// atStatementEnd reports whether the statement ends after the current token:
+// the next token is a semicolon, a closing brace, EOF or sits on a new line.
+func (p *Parser) atStatementEnd() bool {
+	switch p.peekToken.Type {
+	case token.SEMICOLON, token.RBRACE, token.EOF:
+		return true
+	}
+
+	return p.peekOnNewLine()
+}
+
+// peekOnNewLine reports whether a line break separates the current and the
+// next token outside of parentheses, where a newline terminates a statement.
+func (p *Parser) peekOnNewLine() bool {
+	return p.exprLev == 0 && p.peekToken.Pos.Line > p.curToken.End.Line
+}
+
+// expectStatementEnd consumes an optional semicolon and reports anything
+// else left on the line of the statement.
+func (p *Parser) expectStatementEnd() {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+		return
 	}
 
-	return stmt
+	// an INVALID token was reported by the lexer
+	if !p.atStatementEnd() && !p.peekTokenIs(token.INVALID) {
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.UnexpectedToken,
+			Message:  fmt.Sprintf("expected ; or newline after statement, got: %s", p.peekToken.Type),
+			Pos:      p.peekToken.Pos,
+			End:      p.peekToken.End,
+			Expected: []token.TokenType{token.SEMICOLON},
+			Found:    p.peekToken.Type,
+		})
+	}
+}
+
+func (p *Parser) missingExpressionError(after string) {
+	p.errors.Add(&diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.MissingExpression,
+		Message:  fmt.Sprintf("expected expression after %s", after),
+		Pos:      p.curToken.End,
+		End:      p.curToken.End,
+		Found:    p.peekToken.Type,
+	})
 }
 
 func (p *Parser) expectToken(tokenType token.TokenType) bool {
@@ -146,134 +416,343 @@ func (p *Parser) peekTokenIs(tokenType token.TokenType) bool {
 	return p.peekToken.Type == tokenType
 }
 
-func (p *Parser) peekError(should, cur token.TokenType) {
-	msg := fmt.Sprintf("expected next token type to be %s, got: %s", should, cur)
-	p.errors = append(p.errors, msg)
+func (p *Parser) peekError(should token.TokenType) {
+	p.errors.Add(&diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.UnexpectedToken,
+		Message:  fmt.Sprintf("expected next token type to be %s, got: %s", should, p.peekToken.Type),
+		Pos:      p.peekToken.Pos,
+		End:      p.peekToken.End,
+		Expected: []token.TokenType{should},
+		Found:    p.peekToken.Type,
+	})
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// Errors returns the diagnostics of the lexer and the parser reported so
+// far, sorted by position and without duplicates. Past the error limit the
+// list is cut off and ends with a TooManyErrors diagnostic.
+func (p *Parser) Errors() diagnostic.ErrorList {
+	errors := append(diagnostic.ErrorList{}, p.l.Errors()...)
+	errors = append(errors, p.errors...)
+	errors.RemoveMultiples()
+	if p.maxErrors > 0 && len(errors) > p.maxErrors {
+		last := errors[p.maxErrors-1]
+		errors = append(errors[:p.maxErrors], &diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.TooManyErrors,
+			Message:  fmt.Sprintf("too many errors, stopped after %d", p.maxErrors),
+			Pos:      last.Pos,
+			End:      last.End,
+		})
+	}
+
+	return errors
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
-	p.nextToken()
+	if p.atStatementEnd() {
+		// bare return
+		p.expectStatementEnd()
+		return stmt
+	}
 
-	for !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	p.nextToken()
+	stmt.ReturnValue = p.parseExpressionOrBad(LOWEST)
+	if !isBad(stmt.ReturnValue) {
+		p.expectStatementEnd()
 	}
-	return stmt
-}
 
-func (p *Parser) registerPrefixParseFns(tokenType token.TokenType, fn prefixParseFns) {
-	p.prefixParseFns[tokenType] = fn
+	return stmt
 }
 
-func (p *Parser) registerInfixParseFns(tokenType token.TokenType, fn infixParseFns) {
-	p.infixParseFns[tokenType] = fn
-}
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if p.peekTokenIs(token.LBRACE) {
+		p.missingExpressionError("while")
+		return nil
+	}
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
-	stmt.Expression = p.parseExpression(LOWEST)
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if stmt.Condition == nil {
+		return nil
+	}
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
 	}
 
 	return stmt
 }
 
-func (p *Parser) parseGroupedStatement() *ast.BlockStatement {
-	group := &ast.BlockStatement{Token: p.curToken}
+// parseForStatement parses both for name in iterable { } and
+// for init; condition; post { }.
+func (p *Parser) parseForStatement() ast.Statement {
+	tok := p.curToken
 	p.nextToken()
-	if !p.curTokenIs(token.LBRACE) {
+	if p.curTokenIs(token.Identifier) && p.peekTokenIs(token.In) {
+		if stmt := p.parseForInStatement(tok); stmt != nil {
+			return stmt
+		}
+
 		return nil
 	}
-	p.nextToken()
 
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.ParseStatement()
-		if stmt != nil {
-			group.Statements = append(group.Statements, stmt)
+	stmt := &ast.ForStatement{Token: tok}
+	if !p.curTokenIs(token.SEMICOLON) {
+		if stmt.Init = p.parseForClause(); stmt.Init == nil {
+			return nil
 		}
 
+		if !p.expectToken(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+		if stmt.Condition = p.parseExpression(LOWEST); stmt.Condition == nil {
+			return nil
+		}
 	}
 
-	return group
+	if !p.expectToken(token.SEMICOLON) {
+		p.peekError(token.SEMICOLON)
+		return nil
+	}
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		if stmt.Post = p.parseForClause(); stmt.Post == nil {
+			return nil
+		}
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
 }
 
-func (p *Parser) parseIfStatement() *ast.IfStatement {
-	stmt := &ast.IfStatement{Token: p.curToken}
-	p.nextToken()
-	stmt.Condition = p.parseExpression(LOWEST)
-	p.parseGroupedStatement()
+// parseForClause parses the init or post statement of a for loop, a let
+// binding or an expression, leaving its last token as the current one.
+func (p *Parser) parseForClause() ast.Statement {
+	if p.curTokenIs(token.Let) {
+		if stmt := p.parseLetBinding(); stmt != nil && !isBad(stmt.Value) {
+			return stmt
+		}
 
-	if !p.peekTokenIs(token.Else) {
-		return stmt
+		return nil
 	}
 
-	stmt.ElseStatement = p.parseGroupedStatement()
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	if stmt.Expression = p.parseExpression(LOWEST); stmt.Expression == nil {
+		return nil
+	}
 
 	return stmt
 }
 
-func (p *Parser) parseIfExpress() ast.Expression {
-	stmt := &ast.IfExpress{Token: p.curToken}
-	//p.nextToken()
-	if !p.peekTokenIs(token.LPAREN) {
-		return nil
+func (p *Parser) parseForInStatement(tok token.Token) *ast.ForInStatement {
+	stmt := &ast.ForInStatement{
+		Token:    tok,
+		Variable: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
 	}
 
 	p.nextToken()
-	stmt.Condition = p.parseExpression(LOWEST)
-	if !p.peekTokenIs(token.RPAREN) {
+	if p.peekTokenIs(token.LBRACE) {
+		// the body; a hash literal to iterate has to be put in parentheses
+		p.missingExpressionError("in")
 		return nil
 	}
 
 	p.nextToken()
+	if stmt.Iterable = p.parseExpression(LOWEST); stmt.Iterable == nil {
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, where break and continue are
+// allowed, and an optional semicolon after it.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
 	if !p.peekTokenIs(token.LBRACE) {
+		p.peekError(token.LBRACE)
 		return nil
 	}
 
-	p.nextToken()
-	stmt.TrueStatement = p.parseExpression(LOWEST)
+	p.loopDepth++
+	body := p.parseGroupedStatement()
+	p.loopDepth--
+	if body != nil && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
 
-	if !p.peekTokenIs(token.RBRACE) {
+func (p *Parser) parseBranchStatement() *ast.BranchStatement {
+	stmt := &ast.BranchStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.BranchOutsideLoop,
+			Message:  fmt.Sprintf("%s is not in a loop", p.curToken.Literal),
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+		})
 		return nil
 	}
 
-	if !p.peekTokenIs(token.RBRACE) {
+	p.expectStatementEnd()
+	return stmt
+}
+
+func (p *Parser) registerPrefixParseFns(tokenType token.TokenType, fn prefixParseFns) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfixParseFns(tokenType token.TokenType, fn infixParseFns) {
+	p.infixParseFns[tokenType] = fn
+}
+
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
 		return nil
 	}
 
+	// like while and for, an if or switch ending in a block may be followed
+	// by another statement on the same line
+	switch stmt.Expression.(type) {
+	case *ast.IfExpress, *ast.SwitchExpression:
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	default:
+		if !isBad(stmt.Expression) {
+			p.expectStatementEnd()
+		}
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseGroupedStatement() *ast.BlockStatement {
 	p.nextToken()
-	if !p.peekTokenIs(token.Else) {
+	if !p.curTokenIs(token.LBRACE) {
 		return nil
 	}
 
+	group := &ast.BlockStatement{Token: p.curToken}
 	p.nextToken()
-	if !p.peekTokenIs(token.Else) {
+
+	// newlines end statements again inside a block, even within parentheses
+	lev := p.exprLev
+	p.exprLev = 0
+	p.blockDepth++
+	defer func() {
+		p.exprLev = lev
+		p.blockDepth--
+	}()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
+		if p.curTokenIs(token.SEMICOLON) {
+			// an empty statement
+			p.nextToken()
+			continue
+		}
+
+		stmt := p.parseStatementRecover()
+		if stmt != nil {
+			group.Statements = append(group.Statements, stmt)
+		}
+
+		p.nextToken()
+	}
+
+	if !p.curTokenIs(token.RBRACE) {
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.UnexpectedToken,
+			Message:  fmt.Sprintf("expected %s to close the block opened at %s, got: %s", token.RBRACE, group.Token.Pos, p.curToken.Type),
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+			Expected: []token.TokenType{token.RBRACE},
+			Found:    p.curToken.Type,
+		})
 		return nil
 	}
+
+	group.Rbrace = p.curToken
+	return group
+}
+
+// parseIfExpress parses `if cond { } else if cond { } else { }` with
+// optional parentheses around cond. It is used for if in statement and in
+// expression position alike. Every else if becomes an IfExpress nested in
+// the ElseStatement of the previous one.
+func (p *Parser) parseIfExpress() ast.Expression {
+	if exp := p.parseIf(); exp != nil {
+		return exp
+	}
+
+	return nil
+}
+
+func (p *Parser) parseIf() *ast.IfExpress {
+	exp := &ast.IfExpress{Token: p.curToken}
 	p.nextToken()
+	exp.Condition = p.parseExpression(LOWEST)
+	if exp.Condition == nil {
+		return nil
+	}
+
 	if !p.peekTokenIs(token.LBRACE) {
+		p.peekError(token.LBRACE)
 		return nil
 	}
 
-	p.nextToken()
-	stmt.ElseStatement = p.parseExpression(LOWEST)
-	if !p.peekTokenIs(token.RBRACE) {
+	exp.TrueStatement = p.parseGroupedStatement()
+	if exp.TrueStatement == nil {
 		return nil
 	}
 
-	p.nextToken()
-	return stmt
-}
+	if !p.expectToken(token.Else) {
+		return exp
+	}
+
+	switch {
+	case p.expectToken(token.IF):
+		elseIf := p.parseIf()
+		if elseIf == nil {
+			return nil
+		}
 
-func (p *Parser) parseIfExpressBlockStatement() {
+		exp.ElseStatement = elseIf
+	case p.peekTokenIs(token.LBRACE):
+		block := p.parseGroupedStatement()
+		if block == nil {
+			return nil
+		}
 
+		exp.ElseStatement = block
+	default:
+		p.peekError(token.LBRACE)
+		return nil
+	}
+
+	return exp
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -284,7 +763,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 
 	leftExp := prefix()
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && !p.peekOnNewLine() && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -306,10 +785,84 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(lit.Token.Literal, 0, 64)
+	value, err := integerValue(lit.Token.Literal, false)
+	if err != nil {
+		code, msg := diagnostic.InvalidInteger, fmt.Sprintf("could not parse %s as integer", p.curToken.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			code, msg = diagnostic.IntegerOverflow, fmt.Sprintf("integer %s overflows int64", p.curToken.Literal)
+		}
+
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     code,
+			Message:  msg,
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+			Found:    p.curToken.Type,
+		})
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// integerValue parses the integer literal lit, negated if neg is set.
+func integerValue(lit string, neg bool) (int64, error) {
+	// base 0 picks up the 0x, 0o and 0b prefixes, but would also read a
+	// leading zero as octal, so plain decimals are parsed on their own
+	literal, base := lit, 0
+	if len(literal) < 2 || !strings.ContainsAny(literal[1:2], "xXoObB") {
+		literal, base = strings.ReplaceAll(literal, "_", ""), 10
+	}
+	if neg {
+		literal = "-" + literal
+	}
+
+	return strconv.ParseInt(literal, base, 64)
+}
+
+// parseMinInt parses -9223372036854775808, the one integer whose digits
+// overflow on their own, as a single negative literal. It returns nil,
+// consuming nothing, for any other minus.
+func (p *Parser) parseMinInt() ast.Expression {
+	if !p.curTokenIs(token.MINUS) || !p.peekTokenIs(token.Integer) {
+		return nil
+	}
+	if _, err := integerValue(p.peekToken.Literal, false); !errors.Is(err, strconv.ErrRange) {
+		return nil
+	}
+	value, err := integerValue(p.peekToken.Literal, true)
+	if err != nil {
+		return nil
+	}
+
+	minus := p.curToken
+	p.nextToken()
+	return &ast.IntegerLiteral{
+		Token: token.Token{
+			Type:    token.Integer,
+			Literal: "-" + p.curToken.Literal,
+			Pos:     minus.Pos,
+			End:     p.curToken.End,
+		},
+		Value: value,
+	}
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(lit.Token.Literal, "_", ""), 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %s as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.InvalidFloat,
+			Message:  fmt.Sprintf("could not parse %s as float", p.curToken.Literal),
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+			Found:    p.curToken.Type,
+		})
 		return nil
 	}
 
@@ -317,19 +870,73 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseInterpolatedString turns the STRING_HEAD, expression, STRING_MID, ...,
+// STRING_TAIL sequence the lexer produces for "a ${b} c" into a
+// ConcatExpression.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	exp := &ast.ConcatExpression{Token: p.curToken}
+	exp.Parts = append(exp.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+	for {
+		p.nextToken()
+		p.exprLev++
+		part := p.parseExpression(LOWEST)
+		p.exprLev--
+		if part == nil {
+			return nil
+		}
+
+		exp.Parts = append(exp.Parts, part)
+		switch {
+		case p.expectToken(token.StringMid):
+			exp.Parts = append(exp.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		case p.expectToken(token.StringTail):
+			exp.Parts = append(exp.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+			return exp
+		default:
+			p.peekError(token.StringTail)
+			return nil
+		}
+	}
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %q", t)
-	p.errors = append(p.errors, msg)
+	if t == token.INVALID {
+		// the lexer reported it already
+		return
+	}
+
+	p.errors.Add(&diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.NoPrefixParseFn,
+		Message:  fmt.Sprintf("no prefix parse function for %q", t),
+		Pos:      p.curToken.Pos,
+		End:      p.curToken.End,
+		Found:    t,
+		Hint:     "an expression was expected here",
+	})
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
+	if lit := p.parseMinInt(); lit != nil {
+		return lit
+	}
+
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
 
+	if p.missingOperand() {
+		expression.Right = &ast.BadExpression{From: p.curToken.End, To: p.curToken.End}
+		return expression
+	}
+
 	p.nextToken()
-	expression.Right = p.parseExpression(PREFIX)
+	expression.Right = p.parseExpressionOrBad(PREFIX)
 
 	return expression
 }
@@ -345,14 +952,332 @@ func (p *Parser) parseGroupedExpress() ast.Expression {
 	ge := &ast.GroupExpress{Token: p.curToken}
 	p.nextToken()
 
+	p.exprLev++
 	ge.Express = p.parseExpression(LOWEST)
-	if !p.peekTokenIs(token.RPAREN) {
+	p.exprLev--
+	if ge.Express == nil {
+		return &ast.BadExpression{From: ge.Token.Pos, To: p.curToken.End}
+	}
+
+	if isBad(ge.Express) {
+		// reported already, a missing ) would only be a follow-up error
+		p.expectToken(token.RPAREN)
+		return &ast.BadExpression{From: ge.Token.Pos, To: p.curToken.End}
+	}
+
+	if !p.expectToken(token.RPAREN) {
+		p.peekError(token.RPAREN)
+		return &ast.BadExpression{From: ge.Token.Pos, To: p.curToken.End}
+	}
+
+	ge.Rparen = p.curToken
+	return ge
+}
+
+func (p *Parser) parseSwitchExpression() ast.Expression {
+	exp := &ast.SwitchExpression{Token: p.curToken}
+	if !p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		exp.Value = p.parseExpression(LOWEST)
+		if exp.Value == nil {
+			return nil
+		}
+	}
+
+	if !p.expectToken(token.LBRACE) {
+		p.peekError(token.LBRACE)
 		return nil
 	}
 
+	for !p.peekTokenIs(token.RBRACE) {
+		switch {
+		case p.expectToken(token.Case):
+			c := p.parseSwitchCase()
+			if c == nil {
+				return nil
+			}
+
+			exp.Cases = append(exp.Cases, c)
+		case p.expectToken(token.Default):
+			if exp.Default != nil {
+				p.errors.Add(&diagnostic.Diagnostic{
+					Severity: diagnostic.Error,
+					Code:     diagnostic.DuplicateDefault,
+					Message:  fmt.Sprintf("multiple defaults in switch, first at %s", exp.Default.Pos()),
+					Pos:      p.curToken.Pos,
+					End:      p.curToken.End,
+				})
+				return nil
+			}
+
+			if !p.peekTokenIs(token.LBRACE) {
+				p.peekError(token.LBRACE)
+				return nil
+			}
+
+			exp.Default = p.parseGroupedStatement()
+			if exp.Default == nil {
+				return nil
+			}
+		default:
+			p.errors.Add(&diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     diagnostic.UnexpectedToken,
+				Message:  fmt.Sprintf("expected case, default or }, got: %s", p.peekToken.Type),
+				Pos:      p.peekToken.Pos,
+				End:      p.peekToken.End,
+				Expected: []token.TokenType{token.Case, token.Default, token.RBRACE},
+				Found:    p.peekToken.Type,
+			})
+			return nil
+		}
+	}
+
 	p.nextToken()
+	exp.Rbrace = p.curToken
+	return exp
+}
 
-	return ge
+func (p *Parser) parseSwitchCase() *ast.SwitchCase {
+	c := &ast.SwitchCase{Token: p.curToken}
+	if p.peekTokenIs(token.LBRACE) {
+		// the body, not a hash literal value
+		p.missingExpressionError("case")
+		return nil
+	}
+
+	for {
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+
+		c.Values = append(c.Values, value)
+		if !p.expectToken(token.COMMA) {
+			break
+		}
+	}
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.peekError(token.LBRACE)
+		return nil
+	}
+
+	c.Body = p.parseGroupedStatement()
+	if c.Body == nil {
+		return nil
+	}
+
+	return c
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+	if !p.expectToken(token.LPAREN) {
+		p.peekError(token.LPAREN)
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.peekError(token.LBRACE)
+		return nil
+	}
+
+	// break and continue do not reach the loops around the function
+	depth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = depth }()
+
+	lit.Body = p.parseGroupedStatement()
+	if lit.Body == nil {
+		return &ast.BadExpression{From: lit.Token.Pos, To: p.curToken.End}
+	}
+
+	return lit
+}
+
+// parseFunctionParameters parses the identifiers up to the closing
+// parenthesis. It returns nil on error and an empty slice for no parameters.
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+	if p.expectToken(token.RPAREN) {
+		return identifiers
+	}
+
+	for {
+		if !p.expectToken(token.Identifier) {
+			p.peekError(token.Identifier)
+			return nil
+		}
+
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.expectToken(token.COMMA) {
+			break
+		}
+	}
+
+	if !p.expectToken(token.RPAREN) {
+		p.peekError(token.RPAREN)
+		return nil
+	}
+
+	return identifiers
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	call := &ast.CallExpression{Token: p.curToken, Function: function}
+	call.Arguments = p.parseExpressionList(token.RPAREN)
+	if call.Arguments == nil {
+		return nil
+	}
+
+	call.Rparen = p.curToken
+	return call
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+
+	array.Rbracket = p.curToken
+	return array
+}
+
+// parseHashLiteral parses {key: value, ...}. Blocks are only parsed where the
+// grammar expects one, after if, else, fun, switch and case, so a { that
+// starts an expression is always a hash literal.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	p.exprLev++
+	defer func() { p.exprLev-- }()
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
+
+		if !p.expectToken(token.COLON) {
+			p.peekError(token.COLON)
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+		if !p.peekTokenIs(token.RBRACE) && !p.expectToken(token.COMMA) {
+			p.errors.Add(&diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     diagnostic.UnexpectedToken,
+				Message:  fmt.Sprintf("expected , or } in hash literal, got: %s", p.peekToken.Type),
+				Pos:      p.peekToken.Pos,
+				End:      p.peekToken.End,
+				Expected: []token.TokenType{token.COMMA, token.RBRACE},
+				Found:    p.peekToken.Type,
+			})
+			return nil
+		}
+	}
+
+	p.nextToken()
+	hash.Rbrace = p.curToken
+	return hash
+}
+
+// parseIndexExpression parses left[index] as well as the slice forms
+// left[low:high], left[low:], left[:high] and left[:].
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	lbracket := p.curToken
+	p.exprLev++
+	defer func() { p.exprLev-- }()
+
+	var low ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		if p.peekTokenIs(token.RBRACKET) {
+			p.missingExpressionError("[")
+			return nil
+		}
+
+		p.nextToken()
+		if low = p.parseExpression(LOWEST); low == nil {
+			return nil
+		}
+	}
+
+	if !p.expectToken(token.COLON) {
+		if !p.expectToken(token.RBRACKET) {
+			p.peekError(token.RBRACKET)
+			return nil
+		}
+
+		return &ast.IndexExpression{Token: lbracket, Left: left, Index: low, Rbracket: p.curToken}
+	}
+
+	slice := &ast.SliceExpression{Token: lbracket, Left: left, Low: low}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if slice.High = p.parseExpression(LOWEST); slice.High == nil {
+			return nil
+		}
+	}
+
+	if !p.expectToken(token.RBRACKET) {
+		p.peekError(token.RBRACKET)
+		return nil
+	}
+
+	slice.Rbracket = p.curToken
+	return slice
+}
+
+// parseExpressionList parses comma separated expressions up to end, leaving
+// end as the current token. It returns nil on error.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+	if p.expectToken(end) {
+		return list
+	}
+
+	p.exprLev++
+	defer func() { p.exprLev-- }()
+
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
+
+	list = append(list, exp)
+	for p.expectToken(token.COMMA) {
+		p.nextToken()
+		exp = p.parseExpression(LOWEST)
+		if exp == nil {
+			return nil
+		}
+
+		list = append(list, exp)
+	}
+
+	if !p.expectToken(end) {
+		p.peekError(end)
+		return nil
+	}
+
+	return list
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
@@ -362,36 +1287,87 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Operator: p.curToken.Literal,
 	}
 
+	if p.missingOperand() {
+		expression.Right = &ast.BadExpression{From: p.curToken.End, To: p.curToken.End}
+		return expression
+	}
+
 	precedence := p.curPrecedence()
 	p.nextToken()
-	expression.Right = p.parseExpression(precedence)
+	expression.Right = p.parseExpressionOrBad(precedence)
 
 	return expression
 }
 
+// parseAssignExpression parses the assignment operators. They are right
+// associative, a = b = c assigns c to b and then to a.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.errors.Add(&diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.InvalidAssignment,
+			Message:  fmt.Sprintf("cannot assign to %s", target),
+			Pos:      target.Pos(),
+			End:      target.End(),
+			Hint:     "only names and index expressions such as a[i] can be assigned to",
+		})
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: p.curToken, Target: target, Operator: p.curToken.Literal}
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		p.missingExpressionError(p.curToken.Literal)
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	if exp.Value == nil {
+		return nil
+	}
+
+	return exp
+}
+
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LE:       LESSGREATER,
+	token.GE:       LESSGREATER,
+	token.AND:      AND,
+	token.OR:       OR,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence returns the binding power of the infix, assignment or postfix
+// operator t, LOWEST for any other token.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 
 	return LOWEST
 }
 
-func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
 
-	return LOWEST
+func (p *Parser) curPrecedence() int {
+	return Precedence(p.curToken.Type)
 }
@@ -3,12 +3,17 @@ package parser
 import (
 	"fmt"
 	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/diagnostic"
 	"github.com/abusizhishen/zlang/lexer"
+	"github.com/abusizhishen/zlang/token"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestParser_ParseStatement(t *testing.T) {
-	//testLetStatements(t)
+	testLetStatements(t)
+	testReturnStatements(t)
 	testOperatorPrecedenceParsing(t)
 }
 
@@ -51,6 +56,34 @@ let  foobar=8000;
 	fmt.Println(s)
 }
 
+func testReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return 5;", "return 5;"},
+		{"return a + b", "return (a + b);"},
+		{"return;", "return ;"},
+		{"return", "return ;"},
+		{"return\n5", "return ;5"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if _, ok := program.Statements[0].(*ast.ReturnStatement); !ok {
+			t.Fatalf("s not *ast.ReturnStatement. got: %T", program.Statements[0])
+		}
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Fatalf("s.TokenLIteral not let,got:%q", s.TokenLiteral())
@@ -94,7 +127,7 @@ func testOperatorPrecedenceParsing(t *testing.T) {
 		input    string
 		expected string
 	}{
-		{"let a = if (x){x}else{y}", ""},
+		{"let a = if (x){x}else{y}", "let a=if x { x } else { y };"},
 		{"(2+(3+4))+1", "((2 + (3 + 4)) + 1)"},
 		{"(2+3)+1", "((2 + 3) + 1)"},
 		{"1+(2+3)", "(1 + (2 + 3))"},
@@ -111,6 +144,13 @@ func testOperatorPrecedenceParsing(t *testing.T) {
 		{"3+4*5 == 3*1+4*5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
 		{"3+1-2", "((3 + 1) - 2)"},
 		{"1 == 3-2", "(1 == (3 - 2))"},
+		{"a <= b", "(a <= b)"},
+		{"a + 1 >= b * 2", "((a + 1) >= (b * 2))"},
+		{"a <= b == b >= a", "((a <= b) == (b >= a))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"0 <= x && x < 10 || !ok", "(((0 <= x) && (x < 10)) || (!ok))"},
 	}
 
 	for _, tt := range tests {
@@ -127,3 +167,1176 @@ func testOperatorPrecedenceParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		pos, end string
+	}{
+		{"1 + 2 * 3", "1:1", "1:10"},
+		{"  -a", "1:3", "1:5"},
+		{"\n(1 + 2)", "2:1", "2:8"},
+		{"let a = if (x) { 1 } else { 2 }", "1:1", "1:32"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got:%d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if stmt.Pos().String() != tt.pos {
+			t.Errorf("pos wrong. expected=%s, got=%s input:%q", tt.pos, stmt.Pos(), tt.input)
+		}
+
+		if stmt.End().String() != tt.end {
+			t.Errorf("end wrong. expected=%s, got=%s input:%q", tt.end, stmt.End(), tt.input)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	l := lexer.New("let 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatal("expected diagnostics, got none")
+	}
+
+	d := errors[0]
+	if d.Code != diagnostic.UnexpectedToken {
+		t.Errorf("d.Code wrong. expected=%q, got=%q", diagnostic.UnexpectedToken, d.Code)
+	}
+
+	if len(d.Expected) != 1 || d.Expected[0] != token.Identifier || d.Found != token.Integer {
+		t.Errorf("expected/found wrong. got=%v/%v", d.Expected, d.Found)
+	}
+
+	if d.Pos.String() != "1:5" || d.End.String() != "1:6" {
+		t.Errorf("range wrong. got=%s-%s", d.Pos, d.End)
+	}
+
+	if errors.Err() == nil {
+		t.Errorf("errors.Err() returned nil")
+	}
+}
+
+func TestLetStatementValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1 + 2 * 3;", "let a=(1 + (2 * 3));"},
+		{"let a = b", "let a=b;"},
+		{"let a = 1\nlet b = 2", "let a=1;let b=2;"},
+		{"let a = 1\n-2", "let a=1;(-2)"},
+		{"let a = (1\n-2)", "let a=(1 - 2);"},
+		{"let a =\n5", "let a=5;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestEmptyStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1;;2", "12"},
+		{";", ""},
+		{";;\n; let a = 1;;", "let a=1;"},
+		{"fun() { ;; x; }", "fun() { x }"},
+		{"while a { ; }", "while a {  }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLetStatementErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{"let a = ;", diagnostic.MissingExpression},
+		{"let a =", diagnostic.MissingExpression},
+		{"let a = 5 6", diagnostic.UnexpectedToken},
+		{"return 5 6", diagnostic.UnexpectedToken},
+		{"let x = (1", diagnostic.UnexpectedToken},
+		{"return (1", diagnostic.UnexpectedToken},
+		{"1 2", diagnostic.UnexpectedToken},
+		{"f(x) y", diagnostic.UnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedBody   string
+	}{
+		{"fun() {};", []string{}, ""},
+		{"fun(x) { x };", []string{"x"}, "x"},
+		{"fun(x, y) { x + y; }", []string{"x", "y"}, "(x + y)"},
+		{"fun(x, y) {\n let z = x + y\n return z\n}", []string{"x", "y"}, "let z=(x + y);return z;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got:%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("s not *ast.ExpressionStatement. got: %T", program.Statements[0])
+		}
+
+		fn, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression not *ast.FunctionLiteral. got: %T", stmt.Expression)
+		}
+
+		if len(fn.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length of parameters wrong. expected=%d, got=%d", len(tt.expectedParams), len(fn.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			if fn.Parameters[i].Value != ident {
+				t.Errorf("parameter %d wrong. expected=%q, got=%q", i, ident, fn.Parameters[i].Value)
+			}
+		}
+
+		var body string
+		for _, s := range fn.Body.Statements {
+			body += s.String()
+		}
+
+		if body != tt.expectedBody {
+			t.Errorf("body wrong. expected=%q, got=%q", tt.expectedBody, body)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"add(1, 2 * 3, 4 + 5);", "add(1, (2 * 3), (4 + 5))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"f()()", "f()()"},
+		{"fun(x) { x }(5)", "fun(x) { x }(5)"},
+		{"f(\n1,\n2\n)", "f(1, 2)"},
+		{"f\n(1)", "f1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestFunctionParsingErrors(t *testing.T) {
+	tests := []string{
+		"fun x { x }",
+		"fun(x y) { x }",
+		"fun(x) x",
+		"f(1, 2",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", input)
+		}
+	}
+}
+
+func TestIfExpressParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if x { 1 }", "if x { 1 }"},
+		{"if x < y { x } else { y }", "if (x < y) { x } else { y }"},
+		{"if a { 1 } else if b { 2 } else { 3 }", "if a { 1 } else if b { 2 } else { 3 }"},
+		{"if a { 1 } else if b { 2 } else if c { 3 }", "if a { 1 } else if b { 2 } else if c { 3 }"},
+		{"if a {\n let b = 1\n b\n}\nelse {\n 2\n}", "if a { let b=1;b } else { 2 }"},
+		{"if (a) { 1 }", "if a { 1 }"},
+		{"let v = if a { 1 } else { 2 }", "let v=if a { 1 } else { 2 };"},
+		{"let v = if a { let b = 1; b + 1 }", "let v=if a { let b=1;(b + 1) };"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got:%d input:%q", len(program.Statements), tt.input)
+		}
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	l := lexer.New("if a { 1 } else if b { 2 } else { 3 }")
+	program := New(l).ParseProgram()
+	stmt := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpress)
+	elseIf, ok := stmt.ElseStatement.(*ast.IfExpress)
+	if !ok {
+		t.Fatalf("stmt.ElseStatement not *ast.IfExpress. got: %T", stmt.ElseStatement)
+	}
+
+	if _, ok := elseIf.ElseStatement.(*ast.BlockStatement); !ok {
+		t.Fatalf("elseIf.ElseStatement not *ast.BlockStatement. got: %T", elseIf.ElseStatement)
+	}
+}
+
+func TestIfExpressErrors(t *testing.T) {
+	tests := []string{
+		"if x 1",
+		"if x { 1 } else 2",
+		"if x { 1 } else if { 2 }",
+		"if x { 1",
+		"if (x { 1 }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", input)
+		}
+	}
+}
+
+func TestIfFormsShareAST(t *testing.T) {
+	inputs := []string{
+		"if (x) { 1 } else { 2 }",
+		"if x { 1 } else { 2 }",
+		"let a = if (x) { 1 } else { 2 }",
+	}
+
+	for _, input := range inputs {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		var exp ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.ExpressionStatement:
+			exp = stmt.Expression
+		case *ast.LetStatement:
+			exp = stmt.Value
+		}
+
+		ie, ok := exp.(*ast.IfExpress)
+		if !ok {
+			t.Fatalf("expression not *ast.IfExpress. got: %T input:%q", exp, input)
+		}
+
+		if ie.String() != "if x { 1 } else { 2 }" {
+			t.Errorf("ie.String() wrong. got=%q input:%q", ie.String(), input)
+		}
+	}
+}
+
+func TestSwitchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x { case 1 { a } }", "switch x { case 1 { a } }"},
+		{"switch x + 1 {\ncase 1, 2 {\n a\n}\ncase 3 {\n b\n}\ndefault {\n c\n}\n}", "switch (x + 1) { case 1, 2 { a } case 3 { b } default { c } }"},
+		{"switch { case x > 1 { a } default { b } }", "switch { case (x > 1) { a } default { b } }"},
+		{"let v = switch x { default { 1 } case 2 { 3 } }", "let v=switch x { case 2 { 3 } default { 1 } };"},
+		{"switch x { }", "switch x { }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got:%d input:%q", len(program.Statements), tt.input)
+		}
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestSwitchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{"switch x { default { 1 } default { 2 } }", diagnostic.DuplicateDefault},
+		{"switch x { 1 }", diagnostic.UnexpectedToken},
+		{"switch x { case { 1 } }", diagnostic.MissingExpression},
+		{"switch x { case 1 2 }", diagnostic.UnexpectedToken},
+		{"switch x { case 1 { 2 }", diagnostic.UnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestStringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello world"`, `"hello world"`},
+		{`"a\tb\n\"c\" \\"`, `"a\tb\n\"c\" \\"`},
+		{`"cost: \${x}"`, `"cost: \${x}"`},
+		{`"a" + "b"`, `("a" + "b")`},
+		{`"hi ${name}!"`, `"hi ${name}!"`},
+		{`"${a + 1} and ${f("x")}"`, `"${(a + 1)} and ${f("x")}"`},
+		{`"outer ${"inner ${x}"}"`, `"outer ${"inner ${x}"}"`},
+		{"\"${\na\n+ b}\"", `"${(a + b)}"`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	l := lexer.New(`"a ${b} c"`)
+	program := New(l).ParseProgram()
+	concat, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ConcatExpression)
+	if !ok {
+		t.Fatalf("expression not *ast.ConcatExpression. got: %T", program.Statements[0])
+	}
+
+	if len(concat.Parts) != 3 {
+		t.Fatalf("concat.Parts does not contain 3 parts, got:%d", len(concat.Parts))
+	}
+}
+
+func TestStringParsingErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{`let a = "abc`, diagnostic.UnterminatedString},
+		{`"a\qb"`, diagnostic.InvalidEscape},
+		{`"a ${b c}"`, diagnostic.UnexpectedToken},
+		{`"a ${}"`, diagnostic.NoPrefixParseFn},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestNumberLiteralParsing(t *testing.T) {
+	integers := []struct {
+		input    string
+		expected int64
+	}{
+		{"1_000_000", 1000000},
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"0x_ff", 255},
+		{"017", 17},
+		{"9223372036854775807", 9223372036854775807},
+		{"-9223372036854775808", -9223372036854775808},
+		{"-0x8000_0000_0000_0000", -9223372036854775808},
+	}
+
+	for _, tt := range integers {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		lit, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Errorf("expression is not *ast.IntegerLiteral. got=%T input:%q", stmt.Expression, tt.input)
+			continue
+		}
+
+		if lit.Value != tt.expected {
+			t.Errorf("value wrong. expected=%d, got=%d input:%q", tt.expected, lit.Value, tt.input)
+		}
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+		{"1_0.5", 10.5},
+	}
+
+	for _, tt := range floats {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		lit, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Errorf("expression is not *ast.FloatLiteral. got=%T input:%q", stmt.Expression, tt.input)
+			continue
+		}
+
+		if lit.Value != tt.expected {
+			t.Errorf("value wrong. expected=%g, got=%g input:%q", tt.expected, lit.Value, tt.input)
+		}
+
+		if lit.String() != tt.input {
+			t.Errorf("String() wrong. expected=%q, got=%q", tt.input, lit.String())
+		}
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+		pos   string
+	}{
+		{"let a = 9223372036854775808", diagnostic.IntegerOverflow, "1:9"},
+		{"0x8000000000000000", diagnostic.IntegerOverflow, "1:1"},
+		{"1 - 9223372036854775808", diagnostic.IntegerOverflow, "1:5"},
+		{"-9223372036854775809", diagnostic.IntegerOverflow, "1:2"},
+		{"1e400", diagnostic.InvalidFloat, "1:1"},
+		{"let a = 1__0", diagnostic.InvalidNumber, "1:9"},
+		{"0b12", diagnostic.InvalidNumber, "1:1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error, got %d: %v input:%q", len(errors), errors, tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code || errors[0].Pos.String() != tt.pos {
+			t.Errorf("error wrong. expected=%s at %s, got=%s at %s input:%q", tt.code, tt.pos, errors[0].Code, errors[0].Pos, tt.input)
+		}
+	}
+}
+
+func TestCommentParsing(t *testing.T) {
+	input := `// leading
+let a = 10 / 2 // trailing
+/* between
+   lines */
+let b = a /* inline */ * 2`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkErrors(t, p)
+
+	if program.String() != "let a=(10 / 2);let b=(a * 2);" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	if len(program.Comments) != 0 {
+		t.Errorf("comments collected without ScanComments. got=%d", len(program.Comments))
+	}
+
+	l = lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p = New(l)
+	program = p.ParseProgram()
+	checkErrors(t, p)
+
+	if program.String() != "let a=(10 / 2);let b=(a * 2);" {
+		t.Errorf("program.String() wrong with comments. got=%q", program.String())
+	}
+
+	expected := []struct {
+		text string
+		pos  string
+	}{
+		{"// leading", "1:1"},
+		{"// trailing", "2:16"},
+		{"/* between\n   lines */", "3:1"},
+		{"/* inline */", "5:11"},
+	}
+
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("program.Comments does not contain %d comments. got=%d", len(expected), len(program.Comments))
+	}
+
+	for i, tt := range expected {
+		c := program.Comments[i]
+		if c.Text() != tt.text || c.Pos().String() != tt.pos {
+			t.Errorf("comments[%d] wrong. expected=%q at %s, got=%q at %s", i, tt.text, tt.pos, c.Text(), c.Pos())
+		}
+	}
+}
+
+func TestParseFromReader(t *testing.T) {
+	input := `let add = fun(a, b) { a + b } // sum
+let s = "total: ${add(1, 2.5)}"
+if s != "" { return add(0x1, 0b1) } else { s }`
+
+	want := New(lexer.New(input)).ParseProgram()
+	p := New(lexer.NewReader("", iotest.OneByteReader(strings.NewReader(input))))
+	got := p.ParseProgram()
+	checkErrors(t, p)
+
+	if got.String() != want.String() {
+		t.Errorf("program wrong. expected=%q, got=%q", want.String(), got.String())
+	}
+
+	if got.End() != want.End() {
+		t.Errorf("program end wrong. expected=%s, got=%s", want.End(), got.End())
+	}
+}
+
+func TestArrayParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[]", "[]"},
+		{"[1, 2 * 2, \"three\"]", "[1, (2 * 2), \"three\"]"},
+		{"[\n1,\n2\n]", "[1, 2]"},
+		{"a[1 + 1]", "(a[(1 + 1)])"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"f(x)[0]", "(f(x)[0])"},
+		{"a[0](1)", "(a[0])(1)"},
+		{"-a[0]", "(-(a[0]))"},
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:-1]", "(a[:(-1)])"},
+		{"a[2:]", "(a[2:])"},
+		{"a[:]", "(a[:])"},
+		{"a[0][1:][0]", "(((a[0])[1:])[0])"},
+		{"a\n[1]", "a[1]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	l := lexer.New("a[1:3]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkErrors(t, p)
+
+	slice, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("expression is not *ast.SliceExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+
+	if slice.Pos().String() != "1:1" || slice.End().String() != "1:7" {
+		t.Errorf("slice range wrong. got=%s-%s", slice.Pos(), slice.End())
+	}
+}
+
+func TestArrayParsingErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{"[1, 2", diagnostic.UnexpectedToken},
+		{"a[]", diagnostic.MissingExpression},
+		{"a[1", diagnostic.UnexpectedToken},
+		{"a[1:2:3]", diagnostic.UnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"a": 1, 2: true}`, `{"a": 1, 2: true}`},
+		{"{\n\"one\": 0 + 1,\n\"two\": 10 - 8,\n}", `{"one": (0 + 1), "two": (10 - 8)}`},
+		{`{"a": {"b": [1]}}["a"]["b"]`, `(({"a": {"b": [1]}}["a"])["b"])`},
+		{`let h = {x: fun(a) { a }}`, `let h={x: fun(a) { a }};`},
+		{`if {"a": 1}["a"] { 1 }`, `if ({"a": 1}["a"]) { 1 }`},
+		{`switch { case x { {} } }`, `switch { case x { {} } }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	l := lexer.New(`{"one": 1, "two": 2}`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expression is not *ast.HashLiteral. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, key := range []string{"one", "two"} {
+		lit, ok := hash.Pairs[i].Key.(*ast.StringLiteral)
+		if !ok || lit.Value != key {
+			t.Errorf("pairs[%d] key wrong. expected=%q, got=%s", i, key, hash.Pairs[i].Key)
+		}
+
+		if value, ok := hash.Pairs[i].Value.(*ast.IntegerLiteral); !ok || value.Value != int64(i+1) {
+			t.Errorf("pairs[%d] value wrong. expected=%d, got=%s", i, i+1, hash.Pairs[i].Value)
+		}
+	}
+
+	if hash.End().String() != "1:21" {
+		t.Errorf("hash end wrong. got=%s", hash.End())
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{`{"a" 1}`, diagnostic.UnexpectedToken},
+		{`{"a": 1 "b": 2}`, diagnostic.UnexpectedToken},
+		{`{"a": 1`, diagnostic.UnexpectedToken},
+		{`{"a": }`, diagnostic.NoPrefixParseFn},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestLoopParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while x < 10 { x }", "while (x < 10) { x }"},
+		{"while (true) { break }", "while true { break; }"},
+		{"for let i = 0; i < n; let i = i + 1 { f(i) }", "for let i=0; (i < n); let i=(i + 1) { f(i) }"},
+		{"for ; ; { continue; }", "for ; ; { continue; }"},
+		{"for let i = 0; ; { break }", "for let i=0; ; { break; }"},
+		{"for ; i < 3; { i }", "for ; (i < 3); { i }"},
+		{"for x in [1, 2] { x }", "for x in [1, 2] { x }"},
+		{`for k in ({"a": 1}) { k }`, `for k in {"a": 1} { k }`},
+		{"for c in \"abc\" {\n\tif c == \"b\" { continue }\n\tc\n}", `for c in "abc" { if (c == "b") { continue; }c }`},
+		{"while a { while b { break } continue }", "while a { while b { break; }continue; }"},
+		{"while a { 1 }; 2", "while a { 1 }2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+
+	l := lexer.New("for x in xs {\n}")
+	p := New(l)
+	program := p.ParseProgram()
+	checkErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Variable.Value != "x" || stmt.Iterable.String() != "xs" {
+		t.Errorf("for in wrong. got variable=%s iterable=%s", stmt.Variable, stmt.Iterable)
+	}
+
+	if stmt.Pos().String() != "1:1" || stmt.End().String() != "2:2" {
+		t.Errorf("for in range wrong. got=%s-%s", stmt.Pos(), stmt.End())
+	}
+}
+
+func TestLoopParsingErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{"break", diagnostic.BranchOutsideLoop},
+		{"if x { continue }", diagnostic.BranchOutsideLoop},
+		{"while x { fun() { break } }", diagnostic.BranchOutsideLoop},
+		{"while { 1 }", diagnostic.MissingExpression},
+		{"while x 1", diagnostic.UnexpectedToken},
+		{"for x in { 1 }", diagnostic.MissingExpression},
+		{"for let i = 0 { 1 }", diagnostic.UnexpectedToken},
+		{"for let i = 0; i < 1 { 1 }", diagnostic.UnexpectedToken},
+		{"while x { break 1 }", diagnostic.UnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code {
+			t.Errorf("errors[0].Code wrong. expected=%q, got=%q input:%q", tt.code, errors[0].Code, tt.input)
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 1 + 2", "(x = (y = (1 + 2)))"},
+		{"x += 1; y -= 2 * 3", "(x += 1)(y -= (2 * 3))"},
+		{"x *= y /= 2", "(x *= (y /= 2))"},
+		{"a[i + 1] = f(x)", "((a[(i + 1)]) = f(x))"},
+		{`h["k"] += 1`, `((h["k"]) += 1)`},
+		{"a[0][1] = x || y", "(((a[0])[1]) = (x || y))"},
+		{"x =\n5", "(x = 5)"},
+		{"let a = b = 1", "let a=(b = 1);"},
+		{"f(x = 1)", "f((x = 1))"},
+		{"for let i = 0; i < n; i = i + 1 { }", "for let i=0; (i < n); (i = (i + 1)) {  }"},
+		{"x == 1", "(x == 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected: %q, got=%q input:%q", tt.expected, actual, tt.input)
+		}
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+		pos   string
+	}{
+		{"1 = 2", diagnostic.InvalidAssignment, "1:1"},
+		{"a + b = 2", diagnostic.InvalidAssignment, "1:1"},
+		{"f() = 2", diagnostic.InvalidAssignment, "1:1"},
+		{"x = 1 = 2", diagnostic.InvalidAssignment, "1:5"},
+		{"x =", diagnostic.MissingExpression, "1:4"},
+		{"x +=;", diagnostic.MissingExpression, "1:5"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+			continue
+		}
+
+		if errors[0].Code != tt.code || errors[0].Pos.String() != tt.pos {
+			t.Errorf("error wrong. expected=%s at %s, got=%s at %s input:%q", tt.code, tt.pos, errors[0].Code, errors[0].Pos, tt.input)
+		}
+	}
+}
+
+func TestConstStatementParsing(t *testing.T) {
+	l := lexer.New("const limit = 10 * 2\nlimit")
+	p := New(l)
+	program := p.ParseProgram()
+	checkErrors(t, p)
+
+	if program.String() != "const limit=(10 * 2);limit" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "limit" || stmt.End().String() != "1:21" {
+		t.Errorf("const wrong. got name=%s end=%s", stmt.Name, stmt.End())
+	}
+
+	tests := []struct {
+		input string
+		code  diagnostic.Code
+	}{
+		{"const = 1", diagnostic.UnexpectedToken},
+		{"const a", diagnostic.UnexpectedToken},
+		{"const a =", diagnostic.MissingExpression},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0].Code != tt.code {
+			t.Errorf("expected %s error, got %v input:%q", tt.code, errors, tt.input)
+		}
+	}
+
+	// assigning to or redeclaring a constant is for the checker to report
+	for _, input := range []string{"const a = 1; a = 2", "const a = 1; const a = 2"} {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+		checkErrors(t, p)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input   string
+		codes   []diagnostic.Code
+		program string
+	}{
+		{"let = 1; let b = 2", []diagnostic.Code{diagnostic.UnexpectedToken}, "<bad statement>let b=2;"},
+		{"let a = ; let b = 2", []diagnostic.Code{diagnostic.MissingExpression}, "let a=<bad expression>;let b=2;"},
+		{"let a = ) + 1\nlet b = 2", []diagnostic.Code{diagnostic.NoPrefixParseFn}, "let a=<bad expression>;let b=2;"},
+		{"return *\nb", []diagnostic.Code{diagnostic.NoPrefixParseFn}, "return <bad expression>;b"},
+		{"let x 1 2 3\nlet y = )\nlet z = 3", []diagnostic.Code{diagnostic.UnexpectedToken, diagnostic.NoPrefixParseFn}, "<bad statement>let y=<bad expression>;let z=3;"},
+		{"fun(x) { let = 1; x }", []diagnostic.Code{diagnostic.UnexpectedToken}, "fun(x) { <bad statement>x }"},
+		{"if (a) { let a 1 } else { b }; c", []diagnostic.Code{diagnostic.UnexpectedToken}, "if a { <bad statement> } else { b }c"},
+		{"} let a = 1", []diagnostic.Code{diagnostic.NoPrefixParseFn}, "<bad statement>let a=1;"},
+		{"let a = [1, ) let b = 2", []diagnostic.Code{diagnostic.NoPrefixParseFn}, "let a=<bad expression>;let b=2;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.codes) {
+			t.Errorf("wrong number of errors. expected=%d, got=%d (%v) input:%q", len(tt.codes), len(errors), errors, tt.input)
+			continue
+		}
+
+		for i, code := range tt.codes {
+			if errors[i].Code != code {
+				t.Errorf("errors[%d] wrong. expected=%s, got=%s input:%q", i, code, errors[i].Code, tt.input)
+			}
+		}
+
+		if program.String() != tt.program {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.program, program.String())
+		}
+	}
+}
+
+func TestDanglingOperator(t *testing.T) {
+	tests := []struct {
+		input   string
+		errors  []string
+		program string
+	}{
+		{"let y = 3 +\nlet z = (1 +\nreturn z", []string{"1:12", "2:13"}, "let y=(3 + <bad expression>);let z=<bad expression>;return z;"},
+		{"let a = -\nconst b = 1", []string{"1:10"}, "let a=(-<bad expression>);const b=1;"},
+		{"x = 1 *\nwhile x { }", []string{"1:8"}, "(x = (1 * <bad expression>))while x {  }"},
+		{"5 % 2", []string{"1:3"}, "5<bad statement>"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("wrong number of errors. expected=%d, got=%d (%v) input:%q", len(tt.errors), len(errors), errors, tt.input)
+			continue
+		}
+
+		for i, pos := range tt.errors {
+			if errors[i].Pos.String() != pos {
+				t.Errorf("errors[%d] at wrong position. expected=%s, got=%s input:%q", i, pos, errors[i].Pos, tt.input)
+			}
+		}
+
+		if program.String() != tt.program {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.program, program.String())
+		}
+	}
+}
+
+func TestBadNodePositions(t *testing.T) {
+	l := lexer.New("let 1 2\nlet a = )")
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.BadStatement. got=%T", program.Statements[0])
+	}
+
+	if bad.Pos().String() != "1:1" || bad.End().String() != "1:8" {
+		t.Errorf("bad statement covers wrong range. got=%s-%s", bad.Pos(), bad.End())
+	}
+
+	let, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.LetStatement. got=%T", program.Statements[1])
+	}
+
+	if _, ok := let.Value.(*ast.BadExpression); !ok {
+		t.Errorf("let value is not *ast.BadExpression. got=%T", let.Value)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let = 1\n", 20)
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != DefaultMaxErrors+1 {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d", DefaultMaxErrors+1, len(errors))
+	}
+
+	last := errors[len(errors)-1]
+	if last.Code != diagnostic.TooManyErrors || last.Pos.String() != "10:5" {
+		t.Errorf("last error wrong. got=%s at %s", last.Code, last.Pos)
+	}
+
+	l = lexer.New(input)
+	p = New(l)
+	p.SetMaxErrors(0)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 20 {
+		t.Errorf("wrong number of errors without limit. got=%d", len(p.Errors()))
+	}
+}
+
+func TestMissingRparen(t *testing.T) {
+	tests := []string{
+		"(1",
+		"let x = (1",
+		"return (1",
+		"if (x { 1 }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors. expected=1, got=%d (%v) input:%q", len(errors), errors, input)
+			continue
+		}
+
+		if errors[0].Code != diagnostic.UnexpectedToken || len(errors[0].Expected) != 1 || errors[0].Expected[0] != token.RPAREN {
+			t.Errorf("error wrong. expected ), got %q input:%q", errors[0].Message, input)
+		}
+	}
+}
+
+func TestRecoveredTreesAreComplete(t *testing.T) {
+	tests := []struct {
+		input   string
+		program string
+	}{
+		{"1 +", "(1 + <bad expression>)"},
+		{"-", "(-<bad expression>)"},
+		{"let x = 1 + ;", "let x=(1 + <bad expression>);"},
+		{"!(1", "(!<bad expression>)"},
+		{"f(1 + )", "<bad statement>"},
+		{"fun(x) { x", "<bad expression>"},
+		{"let f = fun() {", "let f=<bad expression>;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected diagnostics, got none. input:%q", tt.input)
+		}
+
+		if program.String() != tt.program {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.program, program.String())
+		}
+
+		ast.Inspect(program, func(n ast.Node) bool {
+			if n != nil {
+				n.Pos()
+			}
+			return true
+		})
+
+		if clone := ast.Clone(program); clone.String() != program.String() {
+			t.Errorf("clone wrong. expected=%q, got=%q", program.String(), clone.String())
+		}
+	}
+}
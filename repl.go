@@ -7,7 +7,26 @@ import (
 	"os/user"
 )
 
+// usage: zlang [file | -]
+//
+//	zlang fmt [-w] [files...]
+//	zlang ast [--format=json|sexpr] [file | -]
+//
+// Without arguments zlang starts the REPL, otherwise it runs the script in
+// file, or on standard input for "-". The fmt command formats source files,
+// the ast command prints their syntax tree.
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(fmtCmd(os.Args[2:]))
+		case "ast":
+			os.Exit(astCmd(os.Args[2:]))
+		default:
+			os.Exit(run(os.Args[1]))
+		}
+	}
+
 	u, err := user.Current()
 	if err != nil {
 		fmt.Println(err)
@@ -18,3 +37,25 @@ func main() {
 	fmt.Fprintf(os.Stdout, "feel free to type in command line\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+func run(filename string) int {
+	in := os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		defer f.Close()
+		in = f
+	} else {
+		filename = "<stdin>"
+	}
+
+	if !repl.Run(in, filename, os.Stdout, os.Stderr) {
+		return 1
+	}
+
+	return 0
+}
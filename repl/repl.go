@@ -3,8 +3,13 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"github.com/abusizhishen/zlang/ast"
+	"github.com/abusizhishen/zlang/checker"
+	"github.com/abusizhishen/zlang/diagnostic"
+	"github.com/abusizhishen/zlang/evaluator"
 	"github.com/abusizhishen/zlang/lexer"
-	"github.com/abusizhishen/zlang/token"
+	"github.com/abusizhishen/zlang/object"
+	"github.com/abusizhishen/zlang/parser"
 	"io"
 )
 
@@ -12,17 +17,54 @@ const PROMPT = ">> "
 
 func Start(in io.Reader, out io.Writer) {
 	scaner := bufio.NewScanner(in)
+	env := object.NewEnvironment()
 	for {
-		fmt.Fprintf(out, PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scan := scaner.Scan()
 		if !scan {
 			return
 		}
 
 		line := scaner.Text()
-		lex := lexer.New(line)
-		for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
-			fmt.Fprintf(out, "%+v\n", tok)
+		program, errors := parse(parser.New(lexer.New(line)))
+		if len(errors) != 0 {
+			errors.WriteText(out, line)
+			continue
 		}
+
+		evaluated := evaluator.Eval(program, env)
+		if evaluated != nil {
+			fmt.Fprintln(out, evaluated.Inspect())
+		}
+	}
+}
+
+// Run parses and evaluates the script read from in, streaming it through
+// the lexer instead of loading it first. Diagnostics and runtime errors are
+// printed to errOut. It reports whether the script ran without errors.
+func Run(in io.Reader, filename string, out, errOut io.Writer) bool {
+	program, errors := parse(parser.New(lexer.NewReader(filename, in)))
+	if len(errors) != 0 {
+		errors.WriteText(errOut, "")
+		return false
+	}
+
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(errOut, errObj.Inspect())
+		return false
+	}
+
+	return true
+}
+
+// parse parses the program of p and, if its syntax is fine, checks it. It
+// returns the program and the errors that keep it from being evaluated.
+func parse(p *parser.Parser) (*ast.Program, diagnostic.ErrorList) {
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		return program, errors
 	}
+
+	return program, checker.Check(program)
 }
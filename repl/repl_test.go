@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunRefusesInvalidCode(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if Run(strings.NewReader("puts(1)\nlet x = 1 +"), "test.zl", &out, &errOut) {
+		t.Errorf("Run reported success for invalid code")
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("Run evaluated invalid code. output=%q", out.String())
+	}
+
+	if !strings.Contains(errOut.String(), "test.zl:2:") {
+		t.Errorf("diagnostic not printed. got=%q", errOut.String())
+	}
+}
+
+func TestStartRefusesInvalidCode(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = 1 +\n1 + 2\n"), &out)
+
+	if strings.Contains(out.String(), "cannot evaluate") {
+		t.Errorf("Start evaluated invalid code. output=%q", out.String())
+	}
+
+	if !strings.Contains(out.String(), "3\n") {
+		t.Errorf("Start stopped after invalid code. output=%q", out.String())
+	}
+}
+
+func TestRunChecksProgram(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if Run(strings.NewReader("const a = 1\na = 2\nputs(a)"), "test.zl", &out, &errOut) {
+		t.Errorf("Run reported success for assignment to a constant")
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("Run evaluated a program with errors. output=%q", out.String())
+	}
+
+	if !strings.Contains(errOut.String(), "test.zl:2:1") || !strings.Contains(errOut.String(), "const-assignment") {
+		t.Errorf("checker error not printed. got=%q", errOut.String())
+	}
+}
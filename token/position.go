@@ -0,0 +1,33 @@
+package token
+
+import "fmt"
+
+// Position describes a location in the source. Line and Column start at 1,
+// Offset is the byte offset starting at 0. A zero Position is invalid.
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String returns "file:line:column", "line:column" without a filename, or
+// "-" for an invalid position.
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	if s == "" {
+		s = "-"
+	}
+
+	return s
+}
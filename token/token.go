@@ -1,8 +1,10 @@
 package token
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"` // position of the first character
+	End     Position  `json:"end"` // position immediately after the last character
 }
 
 type TokenType string
@@ -15,13 +17,22 @@ const (
 	ASTERISK           = "*"
 	SLASH              = "/"
 
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LT     = "<"
 	GT     = ">"
@@ -29,34 +40,57 @@ const (
 	GE     = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
+	AND    = "&&"
+	OR     = "||"
 
 	String     = "STRING"
+	StringHead = "STRING_HEAD" // "text${ of an interpolated string
+	StringMid  = "STRING_MID"  // }text${
+	StringTail = "STRING_TAIL" // }text"
 	Integer    = "INTEGER"
+	Float      = "FLOAT"
 	Identifier = "IDENTIFIER"
 	Let        = "LET"
+	Const      = "CONST"
 	IF         = "IF"
 	Else       = "ELSE"
 	Return     = "RETURN"
 	Switch     = "SWITCH"
+	Case       = "CASE"
+	Default    = "DEFAULT"
 	FUN        = "FUN"
+	While      = "WHILE"
+	For        = "FOR"
+	In         = "IN"
+	Break      = "BREAK"
+	Continue   = "CONTINUE"
 	True       = "True"
 	False      = "False"
 
+	Comment = "COMMENT" // only emitted when the lexer scans comments
 	EOF     = "EOF"
 	INVALID = "INVALID"
 )
 
 var Keywords = map[string]TokenType{
-	"let":    Let,
-	"if":     IF,
-	"else":   Else,
-	"return": Return,
-	"switch": Switch,
-	"fun":    FUN,
-	"true":   True,
-	"false":  False,
+	"let":      Let,
+	"const":    Const,
+	"if":       IF,
+	"else":     Else,
+	"return":   Return,
+	"switch":   Switch,
+	"case":     Case,
+	"default":  Default,
+	"fun":      FUN,
+	"while":    While,
+	"for":      For,
+	"in":       In,
+	"break":    Break,
+	"continue": Continue,
+	"true":     True,
+	"false":    False,
 }
 
-func NewToken(t TokenType, ch byte) Token {
+func NewToken(t TokenType, ch rune) Token {
 	return Token{Type: t, Literal: string(ch)}
 }